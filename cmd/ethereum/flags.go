@@ -39,12 +39,14 @@ var (
 	DiffType        string
 	KeyStore        string
 	StartRpc        bool
+	RpcAdmin        bool
 	StartWebSockets bool
 	RpcPort         int
 	NatType         string
 	PMPGateway      string
 	OutboundPort    string
 	ShowGenesis     bool
+	GenesisFile     string
 	AddPeer         string
 	MaxPeer         int
 	GenAddr         bool
@@ -62,6 +64,12 @@ var (
 	DumpNumber      int
 	VmType          int
 	ImportChain     string
+	ExportChain     string
+	ChainStart      int
+	ChainEnd        int
+	SetHead         int
+	PruneBlocks     int
+	TrieCacheSize   int
 	SHH             bool
 	Dial            bool
 	PrintVersion    bool
@@ -97,6 +105,7 @@ func Init() {
 	flag.IntVar(&MaxPeer, "maxpeer", 30, "maximum desired peers")
 	flag.IntVar(&RpcPort, "rpcport", 8080, "port to start json-rpc server on")
 	flag.BoolVar(&StartRpc, "rpc", false, "start rpc server")
+	flag.BoolVar(&RpcAdmin, "rpcadmin", false, "serves the admin api (e.g. AdminApi.SetHead) on the rpc server, only use on trusted networks")
 	flag.BoolVar(&StartWebSockets, "ws", false, "start websocket server")
 	flag.BoolVar(&NonInteractive, "y", false, "non-interactive mode (say yes to confirmations)")
 	flag.BoolVar(&UseSeed, "seed", true, "seed peers")
@@ -113,7 +122,14 @@ func Init() {
 	flag.BoolVar(&DiffTool, "difftool", false, "creates output for diff'ing. Sets LogLevel=0")
 	flag.StringVar(&DiffType, "diff", "all", "sets the level of diff output [vm, all]. Has no effect if difftool=false")
 	flag.BoolVar(&ShowGenesis, "genesis", false, "Dump the genesis block")
-	flag.StringVar(&ImportChain, "chain", "", "Imports given chain")
+	flag.StringVar(&GenesisFile, "genesisfile", "", "JSON file specifying a custom genesis block")
+	flag.StringVar(&ImportChain, "chain", "", "Imports given chain (gzip compressed if the name ends in .gz)")
+	flag.StringVar(&ExportChain, "exportchain", "", "Exports the chain to the given file (gzip compressed if the name ends in .gz)")
+	flag.IntVar(&ChainStart, "chainstart", 0, "first block number to import/export")
+	flag.IntVar(&ChainEnd, "chainend", -1, "last block number to import/export (-1 = up to the last block)")
+	flag.IntVar(&SetHead, "sethead", -1, "rewinds the chain to the given block number before starting")
+	flag.IntVar(&PruneBlocks, "prune", 0, "keeps the state of only the given number of recent blocks (0 = all blocks)")
+	flag.IntVar(&TrieCacheSize, "triecache", 16, "megabytes of trie nodes cached in memory (0 = no cache)")
 
 	flag.BoolVar(&Dump, "dump", false, "output the ethereum state in JSON format. Sub args [number, hash]")
 	flag.StringVar(&DumpHash, "hash", "", "specify arg in hex")
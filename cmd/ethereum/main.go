@@ -27,11 +27,11 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/ethutil"
 	"github.com/ethereum/go-ethereum/logger"
-	"github.com/ethereum/go-ethereum/state"
 )
 
 const (
@@ -60,21 +60,32 @@ func main() {
 
 	utils.InitConfig(VmType, ConfigFile, Datadir, "ETH")
 
+	var genesis *core.Genesis
+	if len(GenesisFile) > 0 {
+		var err error
+		if genesis, err = utils.LoadGenesis(GenesisFile); err != nil {
+			clilogger.Fatalln(err)
+		}
+	}
+
 	ethereum, err := eth.New(&eth.Config{
-		Name:       ClientIdentifier,
-		Version:    Version,
-		KeyStore:   KeyStore,
-		DataDir:    Datadir,
-		LogFile:    LogFile,
-		LogLevel:   LogLevel,
-		Identifier: Identifier,
-		MaxPeers:   MaxPeer,
-		Port:       OutboundPort,
-		NATType:    PMPGateway,
-		PMPGateway: PMPGateway,
-		KeyRing:    KeyRing,
-		Shh:        SHH,
-		Dial:       Dial,
+		Name:          ClientIdentifier,
+		Version:       Version,
+		KeyStore:      KeyStore,
+		DataDir:       Datadir,
+		LogFile:       LogFile,
+		LogLevel:      LogLevel,
+		Identifier:    Identifier,
+		MaxPeers:      MaxPeer,
+		Port:          OutboundPort,
+		NATType:       PMPGateway,
+		PMPGateway:    PMPGateway,
+		KeyRing:       KeyRing,
+		Shh:           SHH,
+		Dial:          Dial,
+		Genesis:       genesis,
+		PruneBlocks:   uint64(PruneBlocks),
+		TrieCacheSize: TrieCacheSize * 1024 * 1024,
 	})
 
 	if err != nil {
@@ -100,34 +111,67 @@ func main() {
 			// We want to output valid JSON
 			fmt.Println("{}")
 
+			ethereum.Close()
 			os.Exit(1)
 		}
 
 		// Leave the Println. This needs clean output for piping
-		statedb := state.New(block.Root(), ethereum.Db())
+		statedb, err := ethereum.ChainManager().StateAt(block.Root())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Println("{}")
+
+			ethereum.Close()
+			os.Exit(1)
+		}
 		fmt.Printf("%s\n", statedb.Dump())
 
 		fmt.Println(block)
 
+		ethereum.Close()
 		return
 	}
 
+	if SetHead >= 0 {
+		if err := ethereum.ChainManager().SetHead(uint64(SetHead)); err != nil {
+			ethereum.Close()
+			clilogger.Fatalln(err)
+		}
+	}
+
 	if StartMining {
 		utils.StartMining(ethereum)
 	}
 
 	if len(ImportChain) > 0 {
 		start := time.Now()
-		err := utils.ImportChain(ethereum, ImportChain)
+		err := utils.ImportChain(ethereum.ChainManager(), ImportChain, uint64(ChainStart), int64(ChainEnd))
 		if err != nil {
 			clilogger.Infoln(err)
 		}
 		clilogger.Infoln("import done in", time.Since(start))
+
+		ethereum.Close()
+		return
+	}
+
+	if len(ExportChain) > 0 {
+		last := ethereum.ChainManager().CurrentBlock().NumberU64()
+		if ChainEnd >= 0 {
+			last = uint64(ChainEnd)
+		}
+
+		err := utils.ExportChainN(ethereum.ChainManager(), ExportChain, uint64(ChainStart), last)
+		if err != nil {
+			clilogger.Infoln(err)
+		}
+
+		ethereum.Close()
 		return
 	}
 
 	if StartRpc {
-		utils.StartRpc(ethereum, RpcPort)
+		utils.StartRpc(ethereum, RpcPort, RpcAdmin)
 	}
 
 	if StartWebSockets {
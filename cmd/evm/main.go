@@ -47,6 +47,7 @@ var (
 	value    = flag.String("value", "0", "tx value")
 	dump     = flag.Bool("dump", false, "dump state after run")
 	data     = flag.String("data", "", "data")
+	trace    = flag.Bool("trace", false, "print a JSON trace of the execution")
 )
 
 func perr(v ...interface{}) {
@@ -69,6 +70,11 @@ func main() {
 	receiver.SetCode(ethutil.Hex2Bytes(*code))
 
 	vmenv := NewEnv(statedb, []byte("evmuser"), ethutil.Big(*value))
+	var tracer *vm.StructLogger
+	if *trace {
+		tracer = vm.NewStructLogger(nil)
+		vmenv.tracer = tracer
+	}
 
 	tstart := time.Now()
 
@@ -83,6 +89,12 @@ func main() {
 		fmt.Println(string(statedb.Dump()))
 	}
 
+	if tracer != nil {
+		if err := vm.WriteTrace(os.Stdout, tracer.StructLogs()); err != nil {
+			perr(err)
+		}
+	}
+
 	var mem runtime.MemStats
 	runtime.ReadMemStats(&mem)
 	fmt.Printf("vm took %v\n", time.Since(tstart))
@@ -104,9 +116,14 @@ type VMEnv struct {
 	transactor []byte
 	value      *big.Int
 
-	depth int
-	Gas   *big.Int
-	time  int64
+	depth      int
+	frameDepth int
+	Gas        *big.Int
+	time       int64
+
+	gasTable  *vm.GasTable
+	jumpTable *vm.JumpTable
+	tracer    vm.Tracer
 }
 
 func NewEnv(state *state.StateDB, transactor []byte, value *big.Int) *VMEnv {
@@ -115,6 +132,8 @@ func NewEnv(state *state.StateDB, transactor []byte, value *big.Int) *VMEnv {
 		transactor: transactor,
 		value:      value,
 		time:       time.Now().Unix(),
+		gasTable:   vm.DefaultGasTable(),
+		jumpTable:  vm.DefaultJumpTable(),
 	}
 }
 
@@ -130,6 +149,13 @@ func (self *VMEnv) Value() *big.Int       { return self.value }
 func (self *VMEnv) GasLimit() *big.Int    { return big.NewInt(1000000000) }
 func (self *VMEnv) Depth() int            { return 0 }
 func (self *VMEnv) SetDepth(i int)        { self.depth = i }
+func (self *VMEnv) FrameDepth() int       { return self.frameDepth }
+func (self *VMEnv) SetFrameDepth(i int)   { self.frameDepth = i }
+
+func (self *VMEnv) GasTable() *vm.GasTable   { return self.gasTable }
+func (self *VMEnv) JumpTable() *vm.JumpTable { return self.jumpTable }
+func (self *VMEnv) Tracer() vm.Tracer        { return self.tracer }
+
 func (self *VMEnv) GetHash(n uint64) []byte {
 	if self.block.Number().Cmp(big.NewInt(int64(n))) == 0 {
 		return self.block.Hash()
@@ -156,7 +182,7 @@ func (self *VMEnv) Call(caller vm.ContextRef, addr, data []byte, gas, price, val
 }
 func (self *VMEnv) CallCode(caller vm.ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error) {
 	exe := self.vm(caller.Address(), data, gas, price, value)
-	return exe.Call(addr, caller)
+	return exe.CallCode(addr, caller)
 }
 
 func (self *VMEnv) Create(caller vm.ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error, vm.ContextRef) {
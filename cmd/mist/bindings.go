@@ -29,7 +29,6 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethutil"
 	"github.com/ethereum/go-ethereum/logger"
-	"github.com/ethereum/go-ethereum/state"
 )
 
 type plugin struct {
@@ -122,7 +121,12 @@ func (self *Gui) DumpState(hash, path string) {
 			return
 		}
 
-		stateDump = state.New(block.Root(), self.eth.Db()).Dump()
+		statedb, err := self.eth.ChainManager().StateAt(block.Root())
+		if err != nil {
+			guilogger.Infoln("dump err: ", err)
+			return
+		}
+		stateDump = statedb.Dump()
 	}
 
 	file, err := os.OpenFile(path[7:], os.O_CREATE|os.O_RDWR, os.ModePerm)
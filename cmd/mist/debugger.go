@@ -21,6 +21,8 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/big"
 	"strconv"
@@ -40,7 +42,6 @@ type DebuggerWindow struct {
 	engine *qml.Engine
 	lib    *UiLib
 
-	vm *vm.DebugVm
 	Db *Debugger
 
 	state *state.StateDB
@@ -57,7 +58,7 @@ func NewDebuggerWindow(lib *UiLib) *DebuggerWindow {
 
 	win := component.CreateWindow(nil)
 
-	w := &DebuggerWindow{engine: engine, win: win, lib: lib, vm: &vm.DebugVm{}}
+	w := &DebuggerWindow{engine: engine, win: win, lib: lib}
 	w.Db = NewDebugger(w)
 
 	return w
@@ -155,6 +156,7 @@ func (self *DebuggerWindow) Debug(valueStr, gasStr, gasPriceStr, scriptStr, data
 	block := self.lib.eth.ChainManager().CurrentBlock()
 
 	env := utils.NewEnv(self.lib.eth.ChainManager(), statedb, block, account.Address(), value)
+	env.SetTracer(self.Db)
 
 	self.Logf("callsize %d", len(script))
 	go func() {
@@ -196,7 +198,7 @@ func (self *DebuggerWindow) Next() {
 }
 
 func (self *DebuggerWindow) Continue() {
-	self.vm.Stepping = false
+	self.Db.stepping = false
 	self.Next()
 }
 
@@ -248,17 +250,23 @@ func (self *DebuggerWindow) ExecCommand(command string) {
 	}
 }
 
+var errDebuggerStopped = errors.New("stopped by the debugger")
+
+// Debugger is a vm.Tracer halting the execution on break points and stepping
+// through it afterwards
 type Debugger struct {
 	N               chan bool
 	Q               chan bool
 	done, interrupt bool
+	stepping        bool
 	breakPoints     []int64
+	code            []byte
 	main            *DebuggerWindow
 	win             *qml.Window
 }
 
 func NewDebugger(main *DebuggerWindow) *Debugger {
-	db := &Debugger{make(chan bool), make(chan bool), true, false, nil, main, main.win}
+	db := &Debugger{N: make(chan bool), Q: make(chan bool), done: true, main: main, win: main.win}
 
 	return db
 }
@@ -267,22 +275,48 @@ type storeVal struct {
 	Key, Value string
 }
 
-func (self *Debugger) BreakHook(pc int, op vm.OpCode, mem *vm.Memory, stack *vm.Stack, stateObject *state.StateObject) bool {
-	self.main.Logln("break on instr:", pc)
+func (self *Debugger) CaptureStart(from, to []byte, create bool, input []byte, gas, value *big.Int) error {
+	self.stepping = false
+
+	return nil
+}
+
+func (self *Debugger) CaptureState(env vm.Environment, pc uint64, op vm.OpCode, gas, cost *big.Int, mem *vm.Memory, stack *vm.Stack, context *vm.Context, depth int) error {
+	// Show the code of the context being executed
+	if !bytes.Equal(self.code, context.Code) {
+		self.code = context.Code
+		self.main.SetAsm(context.Code)
+	}
+
+	for _, instrNo := range self.breakPoints {
+		if pc == uint64(instrNo) {
+			self.main.Logln("break on instr:", pc)
+			self.stepping = true
+		}
+	}
+	if self.stepping && !self.halting(int(pc), op, mem, stack, env.State().GetStateObject(context.Address())) {
+		return errDebuggerStopped
+	}
+
+	return nil
+}
+
+func (self *Debugger) CaptureFault(env vm.Environment, pc uint64, op vm.OpCode, gas, cost *big.Int, mem *vm.Memory, stack *vm.Stack, context *vm.Context, depth int, err error) error {
+	self.main.Logf("fault on instr %d (%v): %v", pc, op, err)
 
-	return self.halting(pc, op, mem, stack, stateObject)
+	return nil
 }
 
-func (self *Debugger) StepHook(pc int, op vm.OpCode, mem *vm.Memory, stack *vm.Stack, stateObject *state.StateObject) bool {
-	return self.halting(pc, op, mem, stack, stateObject)
+func (self *Debugger) CaptureEnd(output []byte, gasUsed *big.Int, err error) error {
+	return nil
 }
 
-func (self *Debugger) SetCode(byteCode []byte) {
-	self.main.SetAsm(byteCode)
+func (self *Debugger) CaptureEnter(typ vm.OpCode, from, to []byte, input []byte, gas, value *big.Int) error {
+	return nil
 }
 
-func (self *Debugger) BreakPoints() []int64 {
-	return self.breakPoints
+func (self *Debugger) CaptureExit(output []byte, gasUsed *big.Int, err error) error {
+	return nil
 }
 
 func (d *Debugger) halting(pc int, op vm.OpCode, mem *vm.Memory, stack *vm.Stack, stateObject *state.StateObject) bool {
@@ -312,9 +346,10 @@ func (d *Debugger) halting(pc int, op vm.OpCode, mem *vm.Memory, stack *vm.Stack
 		d.win.Root().Call("setStack", val.String())
 	}
 
-	it := stateObject.Trie().Iterator()
+	storage := stateObject.Trie()
+	it := storage.Iterator()
 	for it.Next() {
-		d.win.Root().Call("setStorage", storeVal{fmt.Sprintf("% x", it.Key), fmt.Sprintf("% x", it.Value)})
+		d.win.Root().Call("setStorage", storeVal{fmt.Sprintf("% x", storage.GetKey(it.Key)), fmt.Sprintf("% x", it.Value)})
 
 	}
 
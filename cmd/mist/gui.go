@@ -232,10 +232,11 @@ func (gui *Gui) loadAddressBook() {
 	view := gui.getObjectByName("infoView")
 	nameReg := gui.xeth.World().Config().Get("NameReg")
 	if nameReg != nil {
-		it := nameReg.Trie().Iterator()
+		storage := nameReg.Trie()
+		it := storage.Iterator()
 		for it.Next() {
-			if it.Key[0] != 0 {
-				view.Call("addAddress", struct{ Name, Address string }{string(it.Key), ethutil.Bytes2Hex(it.Value)})
+			if key := storage.GetKey(it.Key); len(key) > 0 && key[0] != 0 {
+				view.Call("addAddress", struct{ Name, Address string }{string(key), ethutil.Bytes2Hex(it.Value)})
 			}
 
 		}
@@ -248,13 +249,14 @@ func (self *Gui) loadMergedMiningOptions() {
 	mergeMining := self.xeth.World().Config().Get("MergeMining")
 	if mergeMining != nil {
 		i := 0
-		it := mergeMining.Trie().Iterator()
+		storage := mergeMining.Trie()
+		it := storage.Iterator()
 		for it.Next() {
 			view.Call("addMergedMiningOption", struct {
 				Checked       bool
 				Name, Address string
 				Id, ItemId    int
-			}{false, string(it.Key), ethutil.Bytes2Hex(it.Value), 0, i})
+			}{false, string(storage.GetKey(it.Key)), ethutil.Bytes2Hex(it.Value), 0, i})
 
 			i++
 
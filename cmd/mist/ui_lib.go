@@ -136,7 +136,7 @@ func (self *UiLib) PastPeers() *ethutil.List {
 
 func (self *UiLib) ImportTx(rlpTx string) {
 	tx := types.NewTransactionFromBytes(ethutil.Hex2Bytes(rlpTx))
-	err := self.eth.TxPool().Add(tx)
+	err := self.eth.TxPool().AddLocal(tx)
 	if err != nil {
 		guilogger.Infoln("import tx failed ", err)
 	}
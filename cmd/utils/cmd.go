@@ -22,15 +22,20 @@
 package utils
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strings"
+	"sync"
 
 	"bitbucket.org/kardianos/osext"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth"
@@ -39,16 +44,40 @@ import (
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
-	"github.com/ethereum/go-ethereum/state"
 	"github.com/ethereum/go-ethereum/xeth"
 )
 
 var clilogger = logger.NewLogger("CLI")
-var interruptCallbacks = []func(os.Signal){}
 
-// Register interrupt handlers callbacks
-func RegisterInterrupt(cb func(os.Signal)) {
-	interruptCallbacks = append(interruptCallbacks, cb)
+var (
+	interruptMu        sync.Mutex
+	interruptCallbacks []*interruptCallback
+)
+
+type interruptCallback struct {
+	fn func(os.Signal)
+}
+
+// Register interrupt handlers callbacks. The returned function removes the
+// callback again.
+func RegisterInterrupt(cb func(os.Signal)) func() {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+
+	callback := &interruptCallback{cb}
+	interruptCallbacks = append(interruptCallbacks, callback)
+
+	return func() {
+		interruptMu.Lock()
+		defer interruptMu.Unlock()
+
+		for i, c := range interruptCallbacks {
+			if c == callback {
+				interruptCallbacks = append(interruptCallbacks[:i], interruptCallbacks[i+1:]...)
+				break
+			}
+		}
+	}
 }
 
 // go routine that call interrupt handlers in order of registering
@@ -64,8 +93,12 @@ func HandleInterrupt() {
 }
 
 func RunInterruptCallbacks(sig os.Signal) {
-	for _, cb := range interruptCallbacks {
-		cb(sig)
+	interruptMu.Lock()
+	callbacks := append([]*interruptCallback{}, interruptCallbacks...)
+	interruptMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb.fn(sig)
 	}
 }
 
@@ -124,6 +157,7 @@ func StartEthereum(ethereum *eth.Ethereum, UseSeed bool) {
 	clilogger.Infof("Starting %s", ethereum.ClientIdentity())
 	err := ethereum.Start(UseSeed)
 	if err != nil {
+		ethereum.Close()
 		exit(err)
 	}
 
@@ -190,9 +224,9 @@ func KeyTasks(keyManager *crypto.KeyManager, KeyRing string, GenAddr bool, Secre
 	clilogger.Infof("Main address %x\n", keyManager.Address())
 }
 
-func StartRpc(ethereum *eth.Ethereum, RpcPort int) {
+func StartRpc(ethereum *eth.Ethereum, RpcPort int, admin bool) {
 	var err error
-	ethereum.RpcServer, err = rpc.NewJsonRpcServer(xeth.NewJSXEth(ethereum), RpcPort)
+	ethereum.RpcServer, err = rpc.NewJsonRpcServer(xeth.NewJSXEth(ethereum), RpcPort, admin)
 	if err != nil {
 		clilogger.Errorf("Could not start RPC interface (port %v): %v", RpcPort, err)
 	} else {
@@ -260,8 +294,11 @@ func BlockDo(ethereum *eth.Ethereum, hash []byte) error {
 
 	parent := ethereum.ChainManager().GetBlock(block.ParentHash())
 
-	statedb := state.New(parent.Root(), ethereum.Db())
-	_, err := ethereum.BlockProcessor().TransitionState(statedb, parent, block)
+	statedb, err := ethereum.ChainManager().StateAt(parent.Root())
+	if err != nil {
+		return err
+	}
+	_, err = ethereum.BlockProcessor().TransitionState(statedb, parent, block)
 	if err != nil {
 		return err
 	}
@@ -270,24 +307,146 @@ func BlockDo(ethereum *eth.Ethereum, hash []byte) error {
 
 }
 
-func ImportChain(ethereum *eth.Ethereum, fn string) error {
+// Number of blocks handed to the chain manager at once during imports
+const importBatchSize = 2500
+
+// LoadGenesis reads the JSON genesis specification in the file fn
+func LoadGenesis(fn string) (*core.Genesis, error) {
+	fh, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	return core.ReadGenesis(fh)
+}
+
+// ImportChain imports the RLP encoded blocks in the file fn, which may be gzip
+// compressed if its name ends in ".gz". Only blocks numbered first up to and
+// including last are inserted (last < 0 means no upper bound). Blocks already
+// in the chain are skipped so that an interrupted import can simply be run again.
+func ImportChain(chainmgr *core.ChainManager, fn string, first uint64, last int64) error {
 	clilogger.Infof("importing chain '%s'\n", fn)
-	fh, err := os.OpenFile(fn, os.O_RDONLY, os.ModePerm)
+	fh, err := os.Open(fn)
 	if err != nil {
 		return err
 	}
 	defer fh.Close()
 
-	var chain types.Blocks
-	if err := rlp.Decode(fh, &chain); err != nil {
+	var reader io.Reader = fh
+	if strings.HasSuffix(fn, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return err
+		}
+	}
+
+	// Stop after the current batch when interrupted
+	var (
+		interrupt = make(chan struct{})
+		once      sync.Once
+	)
+	unregister := RegisterInterrupt(func(os.Signal) {
+		once.Do(func() { close(interrupt) })
+	})
+	defer unregister()
+	interrupted := func() bool {
+		select {
+		case <-interrupt:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var (
+		stream                     = rlp.NewStream(reader)
+		batch                      = make(types.Blocks, 0, importBatchSize)
+		imported, skipped, decoded int
+	)
+	insert := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := chainmgr.InsertChain(batch); err != nil {
+			return fmt.Errorf("invalid block in batch #%d - #%d: %v", batch[0].NumberU64(), batch[len(batch)-1].NumberU64(), err)
+		}
+		imported += len(batch)
+		clilogger.Infof("imported %d block(s), skipped %d. Last: #%d\n", imported, skipped, batch[len(batch)-1].NumberU64())
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for !interrupted() {
+		block := new(types.Block)
+		if err := stream.Decode(block); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("at block %d: %v", decoded, err)
+		}
+		decoded++
+
+		number := block.NumberU64()
+		if last >= 0 && number > uint64(last) {
+			break
+		}
+		if number < first || chainmgr.HasBlock(block.Hash()) {
+			skipped++
+			continue
+		}
+
+		batch = append(batch, block)
+		if len(batch) == importBatchSize {
+			if err := insert(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := insert(); err != nil {
+		return err
+	}
+
+	if interrupted() {
+		clilogger.Infoln("import interrupted. Run it again to resume")
+	}
+	clilogger.Infof("imported %d block(s), skipped %d\n", imported, skipped)
+
+	return nil
+}
+
+// ExportChain writes the whole canonical chain to the file fn
+func ExportChain(chainmgr *core.ChainManager, fn string) error {
+	return ExportChainN(chainmgr, fn, 0, chainmgr.CurrentBlock().NumberU64())
+}
+
+// ExportChainN writes the canonical blocks first up to and including last to the
+// file fn. The output is gzip compressed if the file name ends in ".gz".
+func ExportChainN(chainmgr *core.ChainManager, fn string, first, last uint64) error {
+	clilogger.Infof("exporting chain to '%s'\n", fn)
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
 		return err
 	}
+	defer fh.Close()
 
-	ethereum.ChainManager().Reset()
-	if err := ethereum.ChainManager().InsertChain(chain); err != nil {
+	var (
+		writer io.Writer = fh
+		gz     *gzip.Writer
+	)
+	if strings.HasSuffix(fn, ".gz") {
+		gz = gzip.NewWriter(fh)
+		writer = gz
+	}
+
+	if err := chainmgr.ExportN(writer, first, last); err != nil {
 		return err
 	}
-	clilogger.Infof("imported %d blocks\n", len(chain))
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	clilogger.Infof("exported blocks #%d - #%d\n", first, last)
 
 	return nil
 }
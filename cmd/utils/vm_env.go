@@ -37,8 +37,11 @@ type VMEnv struct {
 	transactor []byte
 	value      *big.Int
 
-	depth int
-	Gas   *big.Int
+	depth      int
+	frameDepth int
+	Gas        *big.Int
+
+	tracer vm.Tracer
 }
 
 func NewEnv(chain *core.ChainManager, state *state.StateDB, block *types.Block, transactor []byte, value *big.Int) *VMEnv {
@@ -62,6 +65,18 @@ func (self *VMEnv) Value() *big.Int       { return self.value }
 func (self *VMEnv) State() *state.StateDB { return self.state }
 func (self *VMEnv) Depth() int            { return self.depth }
 func (self *VMEnv) SetDepth(i int)        { self.depth = i }
+func (self *VMEnv) FrameDepth() int       { return self.frameDepth }
+func (self *VMEnv) SetFrameDepth(i int)   { self.frameDepth = i }
+func (self *VMEnv) GasTable() *vm.GasTable {
+	return self.chain.Config().RulesAt(self.block.Number()).GasTable
+}
+func (self *VMEnv) JumpTable() *vm.JumpTable {
+	return self.chain.Config().RulesAt(self.block.Number()).JumpTable
+}
+func (self *VMEnv) Tracer() vm.Tracer { return self.tracer }
+
+// SetTracer makes the VM report every step of its execution to tracer
+func (self *VMEnv) SetTracer(tracer vm.Tracer) { self.tracer = tracer }
 func (self *VMEnv) GetHash(n uint64) []byte {
 	if block := self.chain.GetBlockByNumber(n); block != nil {
 		return block.Hash()
@@ -89,7 +104,7 @@ func (self *VMEnv) Call(caller vm.ContextRef, addr, data []byte, gas, price, val
 }
 func (self *VMEnv) CallCode(caller vm.ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error) {
 	exe := self.vm(caller.Address(), data, gas, price, value)
-	return exe.Call(addr, caller)
+	return exe.CallCode(addr, caller)
 }
 
 func (self *VMEnv) Create(caller vm.ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error, vm.ContextRef) {
@@ -15,6 +15,7 @@ import (
 	"github.com/ethereum/go-ethereum/pow"
 	"github.com/ethereum/go-ethereum/pow/ezp"
 	"github.com/ethereum/go-ethereum/state"
+	"github.com/ethereum/go-ethereum/vm"
 	"gopkg.in/fatih/set.v0"
 )
 
@@ -40,6 +41,8 @@ type BlockProcessor struct {
 	mutex sync.Mutex
 	// Canonical block chain
 	bc *ChainManager
+	// Consensus parameters of the chain
+	config *ChainConfig
 	// non-persistent key/value memory storage
 	mem map[string]*big.Int
 	// Proof of work used for validating
@@ -63,6 +66,7 @@ func NewBlockProcessor(db ethutil.Database, txpool *TxPool, chainManager *ChainM
 		mem:      make(map[string]*big.Int),
 		Pow:      ezp.New(),
 		bc:       chainManager,
+		config:   chainManager.Config(),
 		eventMux: eventMux,
 		txpool:   txpool,
 	}
@@ -72,7 +76,7 @@ func NewBlockProcessor(db ethutil.Database, txpool *TxPool, chainManager *ChainM
 
 func (sm *BlockProcessor) TransitionState(statedb *state.StateDB, parent, block *types.Block) (receipts types.Receipts, err error) {
 	coinbase := statedb.GetOrNewStateObject(block.Header().Coinbase)
-	coinbase.SetGasPool(CalcGasLimit(parent, block))
+	coinbase.SetGasPool(sm.config.CalcGasLimit(parent, block))
 
 	// Process the transactions on to parent state
 	receipts, _, _, _, err = sm.ApplyTransactions(coinbase, statedb, block, block.Transactions(), false)
@@ -150,7 +154,9 @@ done:
 	return receipts, handled, unhandled, erroneous, err
 }
 
-func (sm *BlockProcessor) Process(block *types.Block) (td *big.Int, msgs state.Messages, err error) {
+// Process validates and executes block and writes its state to batch. Nothing
+// is written to the database, the caller writes the batch.
+func (sm *BlockProcessor) Process(block *types.Block, batch ethutil.Batch) (td *big.Int, msgs state.Messages, err error) {
 	// Processing a blocks may never happen simultaneously
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
@@ -165,13 +171,13 @@ func (sm *BlockProcessor) Process(block *types.Block) (td *big.Int, msgs state.M
 	}
 	parent := sm.bc.GetBlock(header.ParentHash)
 
-	return sm.ProcessWithParent(block, parent)
+	return sm.ProcessWithParent(block, parent, batch)
 }
 
-func (sm *BlockProcessor) ProcessWithParent(block, parent *types.Block) (td *big.Int, messages state.Messages, err error) {
+func (sm *BlockProcessor) ProcessWithParent(block, parent *types.Block, batch ethutil.Batch) (td *big.Int, messages state.Messages, err error) {
 	sm.lastAttemptedBlock = block
 
-	state := state.New(parent.Root(), sm.db)
+	state := sm.config.NewState(parent.Root(), sm.db)
 	//state := state.New(parent.Trie().Copy())
 
 	// Block validation
@@ -204,6 +210,8 @@ func (sm *BlockProcessor) ProcessWithParent(block, parent *types.Block) (td *big
 		err = fmt.Errorf("validating receipt root. received=%x got=%x", header.ReceiptHash, receiptSha)
 		return
 	}
+	// Keep the receipts around so they can be stored along with the block
+	block.SetReceipts(receipts)
 
 	if err = sm.AccumelateRewards(state, block, parent); err != nil {
 		return
@@ -218,8 +226,8 @@ func (sm *BlockProcessor) ProcessWithParent(block, parent *types.Block) (td *big
 
 	// Calculate the td for this block
 	td = CalculateTD(block, parent)
-	// Sync the current block's state to the database and cancelling out the deferred Undo
-	state.Sync()
+	// Sync the current block's state to the batch and cancelling out the deferred Undo
+	state.SyncTo(batch)
 	// Set the block hashes for the current messages
 	state.Manifest().SetHash(block.Hash())
 	messages = state.Manifest().Messages
@@ -241,7 +249,7 @@ func (sm *BlockProcessor) ValidateBlock(block, parent *types.Block) error {
 		return fmt.Errorf("Block extra data too long (%d)", len(block.Header().Extra))
 	}
 
-	expd := CalcDifficulty(block, parent)
+	expd := sm.config.CalcDifficulty(block, parent)
 	if expd.Cmp(block.Header().Difficulty) < 0 {
 		fmt.Println("parent\n", parent)
 		return fmt.Errorf("Difficulty check failed for block %v, %v", block.Header().Difficulty, expd)
@@ -268,7 +276,8 @@ func (sm *BlockProcessor) ValidateBlock(block, parent *types.Block) error {
 }
 
 func (sm *BlockProcessor) AccumelateRewards(statedb *state.StateDB, block, parent *types.Block) error {
-	reward := new(big.Int).Set(BlockReward)
+	blockReward := sm.config.RulesAt(block.Number()).BlockReward
+	reward := new(big.Int).Set(blockReward)
 
 	ancestors := set.New()
 	for _, ancestor := range sm.bc.GetAncestors(block, 7) {
@@ -304,12 +313,12 @@ func (sm *BlockProcessor) AccumelateRewards(statedb *state.StateDB, block, paren
 		*/
 
 		r := new(big.Int)
-		r.Mul(BlockReward, big.NewInt(15)).Div(r, big.NewInt(16))
+		r.Mul(blockReward, big.NewInt(15)).Div(r, big.NewInt(16))
 
 		uncleAccount := statedb.GetAccount(uncle.Coinbase)
 		uncleAccount.AddAmount(r)
 
-		reward.Add(reward, new(big.Int).Div(BlockReward, big.NewInt(32)))
+		reward.Add(reward, new(big.Int).Div(blockReward, big.NewInt(32)))
 	}
 
 	// Get the account associated with the coinbase
@@ -338,7 +347,7 @@ func (sm *BlockProcessor) GetMessages(block *types.Block) (messages []*state.Mes
 	var (
 		parent = sm.bc.GetBlock(block.Header().ParentHash)
 		//state  = state.New(parent.Trie().Copy())
-		state = state.New(parent.Root(), sm.db)
+		state = sm.config.NewState(parent.Root(), sm.db)
 	)
 
 	defer state.Reset()
@@ -348,3 +357,38 @@ func (sm *BlockProcessor) GetMessages(block *types.Block) (messages []*state.Mes
 
 	return state.Manifest().Messages, nil
 }
+
+// TraceTransaction replays the transaction with the given hash on the state it
+// was originally executed on and reports its execution to tracer. The earlier
+// transactions of its block are applied first. Like TransitionState it returns
+// the output of the transaction and the error it failed with.
+func (sm *BlockProcessor) TraceTransaction(hash []byte, tracer vm.Tracer) ([]byte, error) {
+	tx, blockHash, index := sm.bc.GetTransaction(hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %x not found", hash)
+	}
+	block := sm.bc.GetBlock(blockHash)
+	if block == nil {
+		return nil, fmt.Errorf("block %x of transaction %x not found", blockHash, hash)
+	}
+	parent := sm.bc.GetBlock(block.ParentHash())
+	if parent == nil {
+		return nil, ParentError(block.ParentHash())
+	}
+
+	statedb, err := sm.bc.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	coinbase := statedb.GetOrNewStateObject(block.Coinbase())
+	coinbase.SetGasPool(sm.config.CalcGasLimit(parent, block))
+
+	if _, _, _, _, err := sm.ApplyTransactions(coinbase, statedb, block, block.Transactions()[:index], true); err != nil {
+		return nil, err
+	}
+
+	env := NewEnv(statedb, sm.bc, tx, block)
+	env.SetTracer(tracer)
+
+	return NewStateTransition(env, tx, statedb.GetStateObject(coinbase.Address())).TransitionState()
+}
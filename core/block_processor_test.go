@@ -0,0 +1,133 @@
+package core
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethutil"
+	"github.com/ethereum/go-ethereum/vm"
+)
+
+func TestTraceTransaction(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sender := crypto.Sha3(crypto.FromECDSAPub(&key.PublicKey)[1:])[12:]
+	contract := ethutil.Hex2Bytes("00000000000000000000000000000000000000aa")
+
+	// The contract increments storage slot 0 on every call
+	genesis := &Genesis{GasLimit: "1000000000", Difficulty: "1", Alloc: map[string]GenesisAccount{
+		ethutil.Bytes2Hex(sender):   {Balance: "1000000000000000000"},
+		ethutil.Bytes2Hex(contract): {Code: "600054600101600055"},
+	}}
+	chainMan, err := benchChainManager(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txs := make(types.Transactions, 2)
+	for i := range txs {
+		txs[i] = types.NewTransactionMessage(contract, big.NewInt(0), big.NewInt(100000), big.NewInt(1), nil)
+		txs[i].SetNonce(uint64(i))
+		txs[i].SignECDSA(key)
+	}
+	if _, err := InsertTestBlock(chainMan, make([]byte, 20), txs); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := vm.NewStructLogger(nil)
+	if _, err := chainMan.processor.(*BlockProcessor).TraceTransaction(txs[1].Hash(), logger); err != nil {
+		t.Fatal(err)
+	}
+	logs := logger.StructLogs()
+	if len(logs) != 7 {
+		t.Fatalf("trace length mismatch: got %d, want 7", len(logs))
+	}
+	// The first transaction has to be replayed for the slot to hold 2
+	last := logs[len(logs)-1]
+	if value := last.Storage[string(make([]byte, 32))]; !bytes.Equal(value, ethutil.LeftPadBytes([]byte{2}, 32)) {
+		t.Errorf("slot 0 mismatch: got %x, want 2", value)
+	}
+	if logger.Error() != nil {
+		t.Errorf("unexpected error: %v", logger.Error())
+	}
+
+	if _, err := chainMan.processor.(*BlockProcessor).TraceTransaction(make([]byte, 32), logger); err == nil {
+		t.Error("expected error for unknown transaction")
+	}
+}
+
+func TestTraceCalls(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sender := crypto.Sha3(crypto.FromECDSAPub(&key.PublicKey)[1:])[12:]
+	caller := ethutil.Hex2Bytes("00000000000000000000000000000000000000aa")
+	callee := ethutil.Hex2Bytes("00000000000000000000000000000000000000bb")
+
+	// The caller sends 1 wei to the callee, which increments storage slot 0
+	genesis := &Genesis{GasLimit: "1000000000", Difficulty: "1", Alloc: map[string]GenesisAccount{
+		ethutil.Bytes2Hex(sender): {Balance: "1000000000000000000"},
+		ethutil.Bytes2Hex(caller): {Balance: "1", Code: "60006000600060006001" + "73" + ethutil.Bytes2Hex(callee) + "612710f100"},
+		ethutil.Bytes2Hex(callee): {Code: "600054600101600055"},
+	}}
+	chainMan, err := benchChainManager(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := types.NewTransactionMessage(caller, big.NewInt(0), big.NewInt(100000), big.NewInt(1), nil)
+	tx.SignECDSA(key)
+	if _, err := InsertTestBlock(chainMan, make([]byte, 20), types.Transactions{tx}); err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := vm.NewCallTracer()
+	if _, err := chainMan.processor.(*BlockProcessor).TraceTransaction(tx.Hash(), tracer); err != nil {
+		t.Fatal(err)
+	}
+	root := tracer.Frame()
+	if root == nil {
+		t.Fatal("no call traced")
+	}
+	if root.Type != vm.CALL || !bytes.Equal(root.From, sender) || !bytes.Equal(root.To, caller) {
+		t.Errorf("root frame mismatch: got %v %x -> %x", root.Type, root.From, root.To)
+	}
+	if len(root.Calls) != 1 {
+		t.Fatalf("nested call count mismatch: got %d, want 1", len(root.Calls))
+	}
+	call := root.Calls[0]
+	if call.Type != vm.CALL || !bytes.Equal(call.From, caller) || !bytes.Equal(call.To, callee) {
+		t.Errorf("nested frame mismatch: got %v %x -> %x", call.Type, call.From, call.To)
+	}
+	if call.Value.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("nested value mismatch: got %v, want 1", call.Value)
+	}
+	if call.Err != nil || call.GasUsed == nil || call.GasUsed.Sign() <= 0 {
+		t.Errorf("nested call not finished: gas used %v, error %v", call.GasUsed, call.Err)
+	}
+	if root.GasUsed == nil || root.GasUsed.Cmp(call.GasUsed) <= 0 {
+		t.Errorf("root gas used %v not above nested %v", root.GasUsed, call.GasUsed)
+	}
+
+	// The caller runs at depth 1 around the CALL, the callee at depth 2
+	logger := vm.NewStructLogger(nil)
+	if _, err := chainMan.processor.(*BlockProcessor).TraceTransaction(tx.Hash(), logger); err != nil {
+		t.Fatal(err)
+	}
+	logs := logger.StructLogs()
+	if len(logs) != 16 {
+		t.Fatalf("trace length mismatch: got %d, want 16", len(logs))
+	}
+	for i, log := range logs {
+		depth := 1
+		if i > 7 && i < 15 {
+			depth = 2
+		}
+		if log.Depth != depth {
+			t.Errorf("step %d (%v): depth %d, want %d", i, log.Op, log.Depth, depth)
+		}
+	}
+	if logs[7].Op != vm.CALL || logs[15].Op != vm.STOP {
+		t.Errorf("unexpected caller steps around the call: %v, %v", logs[7].Op, logs[15].Op)
+	}
+}
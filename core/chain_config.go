@@ -0,0 +1,171 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethutil"
+	"github.com/ethereum/go-ethereum/state"
+	"github.com/ethereum/go-ethereum/vm"
+)
+
+// ChainRules are the consensus parameters in effect from block Block onwards
+type ChainRules struct {
+	// First block the rules apply to
+	Block *big.Int
+
+	// Amount of wei rewarded to the miner of a block
+	BlockReward *big.Int
+
+	// The difficulty changes by parent.difficulty / DifficultyBoundDivisor
+	// per block, it goes down if the block took at least DurationLimit
+	// seconds and up otherwise. It never drops below MinimumDifficulty.
+	DifficultyBoundDivisor *big.Int
+	DurationLimit          uint64
+	MinimumDifficulty      *big.Int
+
+	// The gas limit moves towards 6/5 of the parent's gas usage by at most
+	// parent.gasLimit / GasLimitBoundDivisor, never dropping below MinGasLimit
+	GasLimitBoundDivisor *big.Int
+	MinGasLimit          *big.Int
+
+	// Gas prices and instruction set of the VM
+	GasTable  *vm.GasTable
+	JumpTable *vm.JumpTable
+}
+
+// ChainConfig holds the consensus parameters of a network. Rule changes are
+// scheduled by adding ChainRules activating at later block numbers.
+type ChainConfig struct {
+	NetworkId uint32
+	// Version of the eth wire protocol spoken with the peers of the network,
+	// also recorded in the database
+	ProtocolVersion uint32
+
+	// Gas limit of the genesis block
+	GenesisGasLimit *big.Int
+
+	// Rule sets ordered by activation block, the first one must start at
+	// the genesis block
+	Rules []*ChainRules
+
+	// SecureTrie makes the state tries hash their keys, see
+	// trie.SecureTrie. It changes every state root, including the
+	// genesis state root, and can't be changed for an existing chain.
+	SecureTrie bool
+}
+
+// DefaultChainConfig returns the configuration of the main network
+func DefaultChainConfig() *ChainConfig {
+	return &ChainConfig{
+		NetworkId:       0,
+		ProtocolVersion: 51,
+		GenesisGasLimit: ethutil.BigPow(10, 6),
+		Rules: []*ChainRules{
+			{
+				Block:                  big.NewInt(0),
+				BlockReward:            BlockReward,
+				DifficultyBoundDivisor: big.NewInt(1024),
+				DurationLimit:          13,
+				MinimumDifficulty:      big.NewInt(0),
+				GasLimitBoundDivisor:   big.NewInt(1024),
+				MinGasLimit:            big.NewInt(125000),
+				GasTable:               vm.DefaultGasTable(),
+				JumpTable:              vm.DefaultJumpTable(),
+			},
+		},
+	}
+}
+
+// Validate checks that the rule sets are complete and properly ordered
+func (self *ChainConfig) Validate() error {
+	if self.ProtocolVersion == 0 {
+		return fmt.Errorf("chain config: missing protocol version")
+	}
+	if self.GenesisGasLimit == nil {
+		return fmt.Errorf("chain config: missing genesis gas limit")
+	}
+	if len(self.Rules) == 0 || self.Rules[0].Block == nil || self.Rules[0].Block.Sign() != 0 {
+		return fmt.Errorf("chain config: no rules for the genesis block")
+	}
+
+	for i, rules := range self.Rules {
+		if rules.Block == nil || rules.BlockReward == nil || rules.DifficultyBoundDivisor == nil || rules.MinimumDifficulty == nil || rules.GasLimitBoundDivisor == nil || rules.MinGasLimit == nil || rules.GasTable == nil || rules.JumpTable == nil {
+			return fmt.Errorf("chain config: rule set %d is incomplete", i)
+		}
+		if rules.DifficultyBoundDivisor.Sign() <= 0 || rules.GasLimitBoundDivisor.Sign() <= 0 {
+			return fmt.Errorf("chain config: rule set %d has a zero bound divisor", i)
+		}
+		if i > 0 && rules.Block.Cmp(self.Rules[i-1].Block) <= 0 {
+			return fmt.Errorf("chain config: rule set %d (#%v) doesn't activate after rule set %d (#%v)", i, rules.Block, i-1, self.Rules[i-1].Block)
+		}
+	}
+
+	return nil
+}
+
+// NewState opens the state with the given root in the trie mode of the chain
+func (self *ChainConfig) NewState(root []byte, db ethutil.Database) *state.StateDB {
+	if self.SecureTrie {
+		return state.NewSecure(root, db)
+	}
+
+	return state.New(root, db)
+}
+
+// RulesAt returns the rules in effect for the block with the given number
+func (self *ChainConfig) RulesAt(number *big.Int) *ChainRules {
+	rules := self.Rules[0]
+	for _, r := range self.Rules[1:] {
+		if r.Block.Cmp(number) > 0 {
+			break
+		}
+		rules = r
+	}
+
+	return rules
+}
+
+// CalcDifficulty returns the difficulty block should have given its parent
+func (self *ChainConfig) CalcDifficulty(block, parent *types.Block) *big.Int {
+	rules := self.RulesAt(block.Number())
+	diff := new(big.Int)
+
+	bh, ph := block.Header(), parent.Header()
+	adjust := new(big.Int).Div(ph.Difficulty, rules.DifficultyBoundDivisor)
+	if bh.Time >= ph.Time+rules.DurationLimit {
+		diff.Sub(ph.Difficulty, adjust)
+	} else {
+		diff.Add(ph.Difficulty, adjust)
+	}
+
+	if diff.Cmp(rules.MinimumDifficulty) < 0 {
+		diff.Set(rules.MinimumDifficulty)
+	}
+
+	return diff
+}
+
+// CalcGasLimit returns the gas limit block should have given its parent
+func (self *ChainConfig) CalcGasLimit(parent, block *types.Block) *big.Int {
+	if block.Number().Cmp(big.NewInt(0)) == 0 {
+		return new(big.Int).Set(self.GenesisGasLimit)
+	}
+	rules := self.RulesAt(block.Number())
+
+	// ((divisor-1) * parent.gasLimit + (gasUsed * 6 / 5)) / divisor
+
+	previous := new(big.Int).Mul(new(big.Int).Sub(rules.GasLimitBoundDivisor, ethutil.Big1), parent.GasLimit())
+	current := new(big.Rat).Mul(new(big.Rat).SetInt(parent.GasUsed()), big.NewRat(6, 5))
+	curInt := new(big.Int).Div(current.Num(), current.Denom())
+
+	result := new(big.Int).Add(previous, curInt)
+	result.Div(result, rules.GasLimitBoundDivisor)
+
+	if result.Cmp(rules.MinGasLimit) < 0 {
+		result.Set(rules.MinGasLimit)
+	}
+
+	return result
+}
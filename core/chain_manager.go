@@ -3,6 +3,7 @@ package core
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"math/big"
 	"sync"
 
@@ -16,22 +17,32 @@ import (
 
 var chainlogger = logger.NewLogger("CHAIN")
 
-type StateQuery interface {
-	GetAccount(addr []byte) *state.StateObject
+// blockNumKey returns the database key under which the hash of the canonical
+// block with the given number is stored.
+func blockNumKey(number uint64) []byte {
+	return append([]byte("block-num-"), ethutil.NumberToBytes(number, 64)...)
 }
 
-func CalcDifficulty(block, parent *types.Block) *big.Int {
-	diff := new(big.Int)
+// txLookupKey returns the database key of the lookup entry for the transaction
+// with the given hash.
+func txLookupKey(hash []byte) []byte {
+	return append([]byte("tx-"), hash...)
+}
 
-	bh, ph := block.Header(), parent.Header()
-	adjust := new(big.Int).Rsh(ph.Difficulty, 10)
-	if bh.Time >= ph.Time+13 {
-		diff.Sub(ph.Difficulty, adjust)
-	} else {
-		diff.Add(ph.Difficulty, adjust)
-	}
+// receiptsKey returns the database key under which the receipts of the block
+// with the given hash are stored.
+func receiptsKey(hash []byte) []byte {
+	return append([]byte("receipts-"), hash...)
+}
 
-	return diff
+// txLookupEntry points to the position of a transaction within a block
+type txLookupEntry struct {
+	BlockHash []byte
+	Index     uint64
+}
+
+type StateQuery interface {
+	GetAccount(addr []byte) *state.StateObject
 }
 
 func CalculateTD(block, parent *types.Block) *big.Int {
@@ -48,31 +59,13 @@ func CalculateTD(block, parent *types.Block) *big.Int {
 	return td
 }
 
-func CalcGasLimit(parent, block *types.Block) *big.Int {
-	if block.Number().Cmp(big.NewInt(0)) == 0 {
-		return ethutil.BigPow(10, 6)
-	}
-
-	// ((1024-1) * parent.gasLimit + (gasUsed * 6 / 5)) / 1024
-
-	previous := new(big.Int).Mul(big.NewInt(1024-1), parent.GasLimit())
-	current := new(big.Rat).Mul(new(big.Rat).SetInt(parent.GasUsed()), big.NewRat(6, 5))
-	curInt := new(big.Int).Div(current.Num(), current.Denom())
-
-	result := new(big.Int).Add(previous, curInt)
-	result.Div(result, big.NewInt(1024))
-
-	min := big.NewInt(125000)
-
-	return ethutil.BigMax(min, result)
-}
-
 type ChainManager struct {
 	//eth          EthManager
 	db           ethutil.Database
 	processor    types.BlockProcessor
 	eventMux     *event.TypeMux
 	genesisBlock *types.Block
+	config       *ChainConfig
 	// Last known total difficulty
 	mu              sync.RWMutex
 	td              *big.Int
@@ -81,6 +74,9 @@ type ChainManager struct {
 	lastBlockHash   []byte
 
 	transState *state.StateDB
+
+	// Deletes old state when the node isn't an archive node
+	pruner *state.Pruner
 }
 
 func (self *ChainManager) Td() *big.Int {
@@ -112,13 +108,35 @@ func (self *ChainManager) CurrentBlock() *types.Block {
 }
 
 func NewChainManager(db ethutil.Database, mux *event.TypeMux) *ChainManager {
-	bc := &ChainManager{db: db, genesisBlock: GenesisBlock(db), eventMux: mux}
+	bc := &ChainManager{db: db, genesisBlock: GenesisBlock(db), config: DefaultChainConfig(), eventMux: mux}
 	bc.setLastBlock()
 	bc.transState = bc.State().Copy()
 
 	return bc
 }
 
+// NewChainManagerWithGenesis creates a chain manager on top of the given genesis
+// block, following the consensus rules in config (the default rules if nil).
+// The genesis is written to the database if it's empty, otherwise it must match
+// the genesis the database was created with.
+func NewChainManagerWithGenesis(db ethutil.Database, genesis *types.Block, config *ChainConfig, mux *event.TypeMux) (*ChainManager, error) {
+	if config == nil {
+		config = DefaultChainConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	bc := &ChainManager{db: db, genesisBlock: genesis, config: config, eventMux: mux}
+	bc.setLastBlock()
+	if stored := bc.getBlockHashByNumber(0); !bytes.Equal(stored, genesis.Hash()) {
+		return nil, fmt.Errorf("genesis mismatch: database has %x, expected %x", stored, genesis.Hash())
+	}
+	bc.transState = bc.State().Copy()
+
+	return bc, nil
+}
+
 func (self *ChainManager) Status() (td *big.Int, currentBlock []byte, genesisBlock []byte) {
 	self.mu.RLock()
 	defer self.mu.RUnlock()
@@ -130,8 +148,38 @@ func (self *ChainManager) SetProcessor(proc types.BlockProcessor) {
 	self.processor = proc
 }
 
+// SetPruner makes the chain manager sweep the state older than the blocks
+// retained by pruner as the chain grows. The state written by the processor
+// is tracked by pruner.
+func (self *ChainManager) SetPruner(pruner *state.Pruner) {
+	self.pruner = pruner
+}
+
 func (self *ChainManager) State() *state.StateDB {
-	return state.New(self.CurrentBlock().Root(), self.db)
+	return self.config.NewState(self.CurrentBlock().Root(), self.db)
+}
+
+// StateAt opens the state with the given root in the trie mode of the chain.
+// It fails if the state isn't in the database, such as the state of a block
+// older than those retained by the pruner.
+func (self *ChainManager) StateAt(root []byte) (*state.StateDB, error) {
+	if !self.HasState(root) {
+		return nil, fmt.Errorf("state %x is pruned or unavailable", root)
+	}
+
+	return self.config.NewState(root, self.db), nil
+}
+
+// HasState reports whether the root node of the state with the given root is
+// in the database. It's read from the database itself, the node cache may
+// still hold pruned nodes.
+func (self *ChainManager) HasState(root []byte) bool {
+	if bytes.Equal(root, EmptyListRoot) {
+		return true
+	}
+	data, _ := self.db.Get(root)
+
+	return len(data) > 0
 }
 
 func (self *ChainManager) TransState() *state.StateDB {
@@ -149,6 +197,11 @@ func (bc *ChainManager) setLastBlock() {
 
 		// Set the last know difficulty (might be 0x0 as initial value, Genesis)
 		bc.td = ethutil.BigD(bc.db.LastKnownTD())
+
+		// Make sure the number index is in place for databases created before it existed
+		batch := bc.db.NewBatch()
+		bc.writeCanonical(batch, bc.currentBlock)
+		batch.Write()
 	} else {
 		bc.Reset()
 	}
@@ -180,9 +233,9 @@ func (bc *ChainManager) NewBlock(coinbase []byte) *types.Block {
 	parent := bc.currentBlock
 	if parent != nil {
 		header := block.Header()
-		header.Difficulty = CalcDifficulty(block, parent)
+		header.Difficulty = bc.config.CalcDifficulty(block, parent)
 		header.Number = new(big.Int).Add(parent.Header().Number, ethutil.Big1)
-		header.GasLimit = CalcGasLimit(parent, block)
+		header.GasLimit = bc.config.CalcGasLimit(parent, block)
 
 	}
 
@@ -193,44 +246,158 @@ func (bc *ChainManager) Reset() {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
+	batch := bc.db.NewBatch()
 	for block := bc.currentBlock; block != nil; block = bc.GetBlock(block.Header().ParentHash) {
-		bc.db.Delete(block.Hash())
+		batch.Delete(block.Hash())
 	}
 
 	// Prepare the genesis block
-	bc.write(bc.genesisBlock)
-	bc.insert(bc.genesisBlock)
+	bc.write(batch, bc.genesisBlock)
+	bc.insert(batch, bc.genesisBlock)
 	bc.currentBlock = bc.genesisBlock
 
-	bc.setTotalDifficulty(ethutil.Big("0"))
+	bc.setTotalDifficulty(batch, ethutil.Big("0"))
+
+	if err := batch.Write(); err != nil {
+		chainlogger.Errorln("reset failed:", err)
+	}
 }
 
-func (self *ChainManager) Export() []byte {
-	self.mu.RLock()
-	defer self.mu.RUnlock()
+// SetHead rewinds the canonical chain to the block with the given number. The
+// blocks above it are deleted together with their index entries, receipts and
+// transaction lookups.
+func (bc *ChainManager) SetHead(number uint64) error {
+	head, err := bc.setHead(number)
+	if err != nil {
+		return err
+	}
+	chainlogger.Infof("Rewound chain to #%d (%x) TD=%v\n", number, head.Hash()[:4], head.Td)
+
+	bc.eventMux.Post(ChainHeadEvent{head})
+
+	return nil
+}
+
+func (bc *ChainManager) setHead(number uint64) (*types.Block, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	hash := bc.getBlockHashByNumber(number)
+	if hash == nil {
+		return nil, fmt.Errorf("SetHead: block #%d not found", number)
+	}
+	head := bc.GetBlock(hash)
+	if head == nil || head.Td == nil {
+		return nil, fmt.Errorf("SetHead: block #%d (%x) not found", number, hash[:4])
+	}
+	if bc.pruner != nil && number < bc.pruner.Oldest() {
+		return nil, fmt.Errorf("SetHead: the state of block #%d is pruned, the oldest kept is #%d", number, bc.pruner.Oldest())
+	}
+	transState, err := bc.StateAt(head.Root())
+	if err != nil {
+		return nil, fmt.Errorf("SetHead: block #%d: %v", number, err)
+	}
+
+	batch := bc.db.NewBatch()
+	for block := bc.currentBlock; block != nil && block.NumberU64() > number; block = bc.GetBlock(block.ParentHash()) {
+		for _, tx := range block.Transactions() {
+			batch.Delete(txLookupKey(tx.Hash()))
+		}
+		batch.Delete(receiptsKey(block.Hash()))
+		batch.Delete(block.Hash())
+	}
+
+	bc.insert(batch, head)
+	bc.setTotalDifficulty(batch, head.Td)
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	bc.lastBlockNumber = number
+	bc.transState = transState
+	if bc.pruner != nil {
+		bc.pruner.SetHead(number)
+	}
+
+	return head, nil
+}
 
-	chainlogger.Infof("exporting %v blocks...\n", self.currentBlock.Header().Number)
+// Export writes the canonical chain to w as a stream of RLP encoded blocks
+func (self *ChainManager) Export(w io.Writer) error {
+	return self.ExportN(w, 0, self.CurrentBlock().NumberU64())
+}
 
-	blocks := make([]*types.Block, int(self.currentBlock.NumberU64())+1)
-	for block := self.currentBlock; block != nil; block = self.GetBlock(block.Header().ParentHash) {
-		blocks[block.NumberU64()] = block
+// ExportN writes the canonical blocks first up to and including last to w as a
+// stream of RLP encoded blocks.
+func (self *ChainManager) ExportN(w io.Writer, first, last uint64) error {
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
 	}
 
-	return ethutil.Encode(blocks)
+	chainlogger.Infof("exporting %d block(s) (#%d - #%d)\n", last-first+1, first, last)
+
+	for number := first; number <= last; number++ {
+		block := self.GetBlockByNumber(number)
+		if block == nil {
+			return fmt.Errorf("export failed on #%d: not found", number)
+		}
+
+		if _, err := w.Write(ethutil.Encode(block)); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (bc *ChainManager) insert(block *types.Block) {
+// insert makes the block the head of the chain, its entries are written to
+// batch
+func (bc *ChainManager) insert(batch ethutil.Batch, block *types.Block) {
 	encodedBlock := ethutil.Encode(block)
-	bc.db.Put([]byte("LastBlock"), encodedBlock)
+	batch.Put([]byte("LastBlock"), encodedBlock)
 	bc.currentBlock = block
 	bc.lastBlockHash = block.Hash()
+
+	bc.writeCanonical(batch, block)
+	bc.writeTxLookups(batch, block)
+}
+
+// writeTxLookups stores the lookup entries of the block's transactions. Only
+// blocks of the canonical chain should be passed.
+func (bc *ChainManager) writeTxLookups(batch ethutil.Batch, block *types.Block) {
+	hash := block.Hash()
+	for i, tx := range block.Transactions() {
+		batch.Put(txLookupKey(tx.Hash()), ethutil.Encode([]interface{}{hash, uint64(i)}))
+	}
+}
+
+// writeCanonical makes the given block the head of the number -> hash index. Entries
+// of a previous (longer) canonical chain above the block are removed and ancestors
+// are (re)written until the index agrees with the block's chain again.  The
+// index is read from the database, entries still pending in batch are written
+// again.
+func (bc *ChainManager) writeCanonical(batch ethutil.Batch, block *types.Block) {
+	for number := block.NumberU64() + 1; ; number++ {
+		key := blockNumKey(number)
+		if data, _ := bc.db.Get(key); len(data) == 0 {
+			break
+		}
+		batch.Delete(key)
+	}
+
+	for ; block != nil; block = bc.GetBlock(block.ParentHash()) {
+		key := blockNumKey(block.NumberU64())
+		if data, _ := bc.db.Get(key); bytes.Equal(data, block.Hash()) {
+			break
+		}
+		batch.Put(key, block.Hash())
+	}
 }
 
-func (bc *ChainManager) write(block *types.Block) {
-	bc.writeBlockInfo(block)
+func (bc *ChainManager) write(batch ethutil.Batch, block *types.Block) {
+	bc.writeBlockInfo(batch, block)
 
 	encodedBlock := ethutil.Encode(block.RlpDataForStorage())
-	bc.db.Put(block.Hash(), encodedBlock)
+	batch.Put(block.Hash(), encodedBlock)
 }
 
 // Accessors
@@ -238,6 +405,11 @@ func (bc *ChainManager) Genesis() *types.Block {
 	return bc.genesisBlock
 }
 
+// Config returns the consensus parameters the chain is validated against
+func (bc *ChainManager) Config() *ChainConfig {
+	return bc.config
+}
+
 // Block fetching methods
 func (bc *ChainManager) HasBlock(hash []byte) bool {
 	data, _ := bc.db.Get(hash)
@@ -250,6 +422,19 @@ func (self *ChainManager) GetBlockHashesFromHash(hash []byte, max uint64) (chain
 		return
 	}
 
+	// Ancestors of a canonical block can be read straight from the number index
+	if number := block.NumberU64(); bytes.Equal(self.getBlockHashByNumber(number), hash) {
+		for i := uint64(1); i <= max && i <= number; i++ {
+			parentHash := self.getBlockHashByNumber(number - i)
+			if parentHash == nil {
+				break
+			}
+			chain = append(chain, parentHash)
+		}
+
+		return
+	}
+
 	// XXX Could be optimised by using a different database which only holds hashes (i.e., linked list)
 	for i := uint64(0); i < max; i++ {
 		block = self.GetBlock(block.Header().ParentHash)
@@ -276,6 +461,61 @@ func (self *ChainManager) GetBlock(hash []byte) *types.Block {
 	return &block
 }
 
+// GetTransaction returns the transaction with the given hash together with the
+// hash of the block it was included in and its index within that block. The
+// transaction is nil if it isn't known.
+func (self *ChainManager) GetTransaction(hash []byte) (tx *types.Transaction, blockHash []byte, index uint64) {
+	data, _ := self.db.Get(txLookupKey(hash))
+	if len(data) == 0 {
+		return nil, nil, 0
+	}
+
+	var entry txLookupEntry
+	if err := rlp.Decode(bytes.NewReader(data), &entry); err != nil {
+		chainlogger.Errorf("invalid tx lookup entry for %x: %v\n", hash, err)
+		return nil, nil, 0
+	}
+
+	block := self.GetBlock(entry.BlockHash)
+	if block == nil || entry.Index >= uint64(len(block.Transactions())) {
+		return nil, nil, 0
+	}
+
+	return block.Transactions()[entry.Index], entry.BlockHash, entry.Index
+}
+
+// GetReceipt returns the receipt of the transaction with the given hash or nil
+// if either the transaction or its receipt isn't known.
+func (self *ChainManager) GetReceipt(txHash []byte) *types.Receipt {
+	tx, blockHash, index := self.GetTransaction(txHash)
+	if tx == nil {
+		return nil
+	}
+
+	receipts := self.GetReceipts(blockHash)
+	if index >= uint64(len(receipts)) {
+		return nil
+	}
+
+	return receipts[index]
+}
+
+// GetReceipts returns the receipts of the block with the given hash
+func (self *ChainManager) GetReceipts(blockHash []byte) types.Receipts {
+	data, _ := self.db.Get(receiptsKey(blockHash))
+	if len(data) == 0 {
+		return nil
+	}
+
+	var receipts types.Receipts
+	it := ethutil.NewValueFromBytes(data).NewIterator()
+	for it.Next() {
+		receipts = append(receipts, types.NewRecieptFromValue(it.Value()))
+	}
+
+	return receipts
+}
+
 func (self *ChainManager) GetUnclesInChain(block *types.Block, length int) (uncles []*types.Header) {
 	for i := 0; block != nil && i < length; i++ {
 		uncles = append(uncles, block.Uncles()...)
@@ -302,22 +542,27 @@ func (self *ChainManager) GetBlockByNumber(num uint64) *types.Block {
 	self.mu.RLock()
 	defer self.mu.RUnlock()
 
-	var block *types.Block
+	hash := self.getBlockHashByNumber(num)
+	if hash == nil {
+		return nil
+	}
 
-	if num <= self.currentBlock.Number().Uint64() {
-		block = self.currentBlock
-		for ; block != nil; block = self.GetBlock(block.Header().ParentHash) {
-			if block.Header().Number.Uint64() == num {
-				break
-			}
-		}
+	return self.GetBlock(hash)
+}
+
+// getBlockHashByNumber returns the hash of the canonical block with the given
+// number or nil if there's no such block.
+func (self *ChainManager) getBlockHashByNumber(num uint64) []byte {
+	data, _ := self.db.Get(blockNumKey(num))
+	if len(data) == 0 {
+		return nil
 	}
 
-	return block
+	return data
 }
 
-func (bc *ChainManager) setTotalDifficulty(td *big.Int) {
-	bc.db.Put([]byte("LTD"), td.Bytes())
+func (bc *ChainManager) setTotalDifficulty(batch ethutil.Batch, td *big.Int) {
+	batch.Put([]byte("LTD"), td.Bytes())
 	bc.td = td
 }
 
@@ -342,8 +587,12 @@ func (self *ChainManager) CalcTotalDiff(block *types.Block) (*big.Int, error) {
 }
 
 // Unexported method for writing extra non-essential block info to the db
-func (bc *ChainManager) writeBlockInfo(block *types.Block) {
+func (bc *ChainManager) writeBlockInfo(batch ethutil.Batch, block *types.Block) {
 	bc.lastBlockNumber++
+
+	if receipts := block.Receipts(); receipts != nil {
+		batch.Put(receiptsKey(block.Hash()), receipts.RlpEncode())
+	}
 }
 
 func (bc *ChainManager) Stop() {
@@ -353,8 +602,20 @@ func (bc *ChainManager) Stop() {
 }
 
 func (self *ChainManager) InsertChain(chain types.Blocks) error {
+	// Recover the senders up front using all cores, processing is serial
+	recoverBlockSenders(chain)
+
 	for _, block := range chain {
-		td, messages, err := self.processor.Process(block)
+		// The state of the block, the block and its index entries are
+		// written in a single batch, a crash can't leave the block half
+		// written. Only the state is tracked by the pruner.
+		batch := self.db.NewBatch()
+		stateBatch := batch
+		if self.pruner != nil {
+			stateBatch = self.pruner.Track(batch)
+		}
+
+		td, messages, err := self.processor.Process(block, stateBatch)
 		if err != nil {
 			if IsKnownBlockErr(err) {
 				continue
@@ -368,30 +629,131 @@ func (self *ChainManager) InsertChain(chain types.Blocks) error {
 		}
 		block.Td = td
 
+		var (
+			events []interface{}
+			head   bool
+		)
 		self.mu.Lock()
+		// A concurrent SetHead may have deleted the parent while the block
+		// was processed, the block can't be written on top of the gap
+		if !self.HasBlock(block.ParentHash()) {
+			self.mu.Unlock()
+			chainlogger.Infof("block #%v parent removed during processing (%x)\n", block.Number(), block.Hash()[:4])
+			return ParentError(block.ParentHash())
+		}
 		{
-			self.write(block)
+			self.write(batch, block)
 			cblock := self.currentBlock
 			if td.Cmp(self.td) > 0 {
-				if block.Header().Number.Cmp(new(big.Int).Add(cblock.Header().Number, ethutil.Big1)) < 0 {
+				if !bytes.Equal(block.ParentHash(), cblock.Hash()) {
 					chainlogger.Infof("Split detected. New head #%v (%x) TD=%v, was #%v (%x) TD=%v\n", block.Header().Number, block.Hash()[:4], td, cblock.Header().Number, cblock.Hash()[:4], self.td)
+
+					events = append(events, self.reorg(batch, cblock, block)...)
 				}
 
-				self.setTotalDifficulty(td)
-				self.insert(block)
-				self.transState = state.New(cblock.Root(), self.db) //state.New(cblock.Trie().Copy())
+				self.setTotalDifficulty(batch, td)
+				self.insert(batch, block)
+
+				events = append(events, ChainHeadEvent{block})
+				head = true
+			} else {
+				events = append(events, ChainSideEvent{block})
 			}
 
+			if err = batch.Write(); err == nil && head {
+				self.transState = self.config.NewState(block.Root(), self.db)
+			}
 		}
 		self.mu.Unlock()
 
+		if err != nil {
+			chainlogger.Errorf("block #%v write failed (%x): %v\n", block.Number(), block.Hash()[:4], err)
+			return err
+		}
+
+		if head && self.pruner != nil && self.pruner.SetHead(block.NumberU64()) {
+			self.prune(block)
+		}
+
 		self.eventMux.Post(NewBlockEvent{block})
 		self.eventMux.Post(messages)
+		for _, event := range events {
+			self.eventMux.Post(event)
+		}
 	}
 
 	return nil
 }
 
+// prune sweeps the state which isn't part of the retained blocks ending in head
+func (self *ChainManager) prune(head *types.Block) {
+	var roots [][]byte
+	for block := head; block != nil && uint64(len(roots)) < self.pruner.Retain(); block = self.GetBlock(block.ParentHash()) {
+		roots = append(roots, block.Root())
+	}
+	self.pruner.Sweep(roots)
+}
+
+// reorg makes the chain ending in newHead canonical in place of the chain ending
+// in oldHead. It finds their common ancestor, rewrites the number index and the
+// transaction lookup entries and returns the events describing the abandoned
+// blocks and the transactions which are no longer part of the canonical chain.
+// The changes are written to batch.
+func (self *ChainManager) reorg(batch ethutil.Batch, oldHead, newHead *types.Block) (events []interface{}) {
+	var (
+		oldChain, newChain types.Blocks
+		oldBlock, newBlock = oldHead, newHead
+	)
+
+	// Walk back the longer chain until both are at the same height
+	for ; oldBlock != nil && oldBlock.NumberU64() > newBlock.NumberU64(); oldBlock = self.GetBlock(oldBlock.ParentHash()) {
+		oldChain = append(oldChain, oldBlock)
+	}
+	for ; oldBlock != nil && newBlock != nil && newBlock.NumberU64() > oldBlock.NumberU64(); newBlock = self.GetBlock(newBlock.ParentHash()) {
+		newChain = append(newChain, newBlock)
+	}
+	// Walk back both chains until the common ancestor is found
+	for oldBlock != nil && newBlock != nil && !bytes.Equal(oldBlock.Hash(), newBlock.Hash()) {
+		oldChain = append(oldChain, oldBlock)
+		newChain = append(newChain, newBlock)
+
+		oldBlock, newBlock = self.GetBlock(oldBlock.ParentHash()), self.GetBlock(newBlock.ParentHash())
+	}
+	if oldBlock == nil || newBlock == nil {
+		chainlogger.Errorf("reorg: unable to find common ancestor of %x and %x\n", oldHead.Hash()[:4], newHead.Hash()[:4])
+		return nil
+	}
+	chainlogger.Infof("reorg: common ancestor #%v (%x). Dropping %d block(s), adding %d block(s)\n", oldBlock.Number(), oldBlock.Hash()[:4], len(oldChain), len(newChain))
+
+	self.writeCanonical(batch, newHead)
+
+	included := make(map[string]bool)
+	for _, block := range newChain {
+		self.writeTxLookups(batch, block)
+		for _, tx := range block.Transactions() {
+			included[string(tx.Hash())] = true
+		}
+	}
+
+	var removed types.Transactions
+	for _, block := range oldChain {
+		for _, tx := range block.Transactions() {
+			if !included[string(tx.Hash())] {
+				batch.Delete(txLookupKey(tx.Hash()))
+				removed = append(removed, tx)
+			}
+		}
+
+		events = append(events, ChainSideEvent{block})
+	}
+
+	if len(removed) > 0 {
+		events = append(events, RemovedTransactionsEvent{removed})
+	}
+
+	return events
+}
+
 // Satisfy state query interface
 func (self *ChainManager) GetAccount(addr []byte) *state.StateObject {
 	return self.State().GetAccount(addr)
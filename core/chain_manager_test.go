@@ -3,17 +3,24 @@ package core
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"math/big"
 	"os"
 	"path"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethutil"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/state"
+	"github.com/ethereum/go-ethereum/vm"
 )
 
 func init() {
@@ -62,7 +69,7 @@ func TestChainInsertions(t *testing.T) {
 
 	var eventMux event.TypeMux
 	chainMan := NewChainManager(db, &eventMux)
-	txPool := NewTxPool(&eventMux)
+	txPool := NewTxPool(&eventMux, chainMan)
 	blockMan := NewBlockProcessor(db, txPool, chainMan, &eventMux)
 	chainMan.SetProcessor(blockMan)
 
@@ -106,7 +113,7 @@ func TestChainMultipleInsertions(t *testing.T) {
 	}
 	var eventMux event.TypeMux
 	chainMan := NewChainManager(db, &eventMux)
-	txPool := NewTxPool(&eventMux)
+	txPool := NewTxPool(&eventMux, chainMan)
 	blockMan := NewBlockProcessor(db, txPool, chainMan, &eventMux)
 	chainMan.SetProcessor(blockMan)
 	done := make(chan bool, max)
@@ -139,10 +146,704 @@ func TestGetAncestors(t *testing.T) {
 		t.FailNow()
 	}
 
+	batch := db.NewBatch()
 	for _, block := range chain {
-		chainMan.write(block)
+		chainMan.write(batch, block)
 	}
+	batch.Write()
 
 	ancestors := chainMan.GetAncestors(chain[len(chain)-1], 4)
 	fmt.Println(ancestors)
 }
+
+func TestBlockNumberIndex(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	chain1, err := loadChain("valid1", t)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+
+	chain2, err := loadChain("valid2", t)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+
+	var eventMux event.TypeMux
+	chainMan := NewChainManager(db, &eventMux)
+	txPool := NewTxPool(&eventMux, chainMan)
+	blockMan := NewBlockProcessor(db, txPool, chainMan, &eventMux)
+	chainMan.SetProcessor(blockMan)
+
+	if err := chainMan.InsertChain(chain2); err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range chain2 {
+		if b := chainMan.GetBlockByNumber(block.NumberU64()); b == nil || !bytes.Equal(b.Hash(), block.Hash()) {
+			t.Fatalf("block #%d not indexed", block.NumberU64())
+		}
+	}
+
+	// chain1 has a higher TD and replaces chain2 as the canonical chain
+	if err := chainMan.InsertChain(chain1); err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range chain1 {
+		if b := chainMan.GetBlockByNumber(block.NumberU64()); b == nil || !bytes.Equal(b.Hash(), block.Hash()) {
+			t.Errorf("block #%d not indexed after fork switch", block.NumberU64())
+		}
+	}
+	if b := chainMan.GetBlockByNumber(chain1[len(chain1)-1].NumberU64() + 1); b != nil {
+		t.Errorf("expected no block beyond the head, got #%d", b.NumberU64())
+	}
+
+	head := chain1[len(chain1)-1]
+	hashes := chainMan.GetBlockHashesFromHash(head.Hash(), 3)
+	if len(hashes) != 3 {
+		t.Fatalf("expected 3 hashes, got %d", len(hashes))
+	}
+	for i, hash := range hashes {
+		if !bytes.Equal(hash, chain1[len(chain1)-2-i].Hash()) {
+			t.Errorf("hash %d mismatch: %x", i, hash)
+		}
+	}
+}
+
+func TestTransactionLookup(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	var eventMux event.TypeMux
+	chainMan := NewChainManager(db, &eventMux)
+
+	key, _ := crypto.GenerateKey()
+	var (
+		txs      types.Transactions
+		receipts types.Receipts
+	)
+	for i := 0; i < 3; i++ {
+		tx := types.NewTransactionMessage(make([]byte, 20), big.NewInt(100), big.NewInt(21000), big.NewInt(1), nil)
+		tx.SetNonce(uint64(i))
+		tx.SignECDSA(key)
+		txs = append(txs, tx)
+		receipts = append(receipts, types.NewReceipt(make([]byte, 32), big.NewInt(int64(21000*(i+1)))))
+	}
+
+	block := chainMan.NewBlock(make([]byte, 20))
+	block.SetTransactions(txs)
+	block.SetReceipts(receipts)
+	block.Td = block.Difficulty()
+	batch := db.NewBatch()
+	chainMan.write(batch, block)
+	chainMan.insert(batch, block)
+	batch.Write()
+
+	for i, tx := range txs {
+		btx, hash, index := chainMan.GetTransaction(tx.Hash())
+		if btx == nil {
+			t.Fatalf("tx %d not found", i)
+		}
+		if !bytes.Equal(btx.Hash(), tx.Hash()) || !bytes.Equal(hash, block.Hash()) || index != uint64(i) {
+			t.Errorf("tx %d: invalid lookup (%x, %x, %d)", i, btx.Hash(), hash, index)
+		}
+
+		receipt := chainMan.GetReceipt(tx.Hash())
+		if receipt == nil {
+			t.Fatalf("receipt %d not found", i)
+		}
+		if receipt.CumulativeGasUsed.Cmp(receipts[i].CumulativeGasUsed) != 0 {
+			t.Errorf("receipt %d: cumulative gas mismatch %v != %v", i, receipt.CumulativeGasUsed, receipts[i].CumulativeGasUsed)
+		}
+	}
+
+	if tx, _, _ := chainMan.GetTransaction(make([]byte, 32)); tx != nil {
+		t.Error("expected unknown transaction to be nil")
+	}
+}
+
+func newTestBlock(chainMan *ChainManager, parent *types.Block, coinbase byte, txs types.Transactions) *types.Block {
+	coinbaseAddr := make([]byte, 20)
+	coinbaseAddr[0] = coinbase
+
+	block := types.NewBlock(parent.Hash(), coinbaseAddr, parent.Root(), parent.Difficulty(), nil, "")
+	block.Header().Number = new(big.Int).Add(parent.Number(), ethutil.Big1)
+	block.SetUncles(nil)
+	block.SetTransactions(txs)
+	block.Td = new(big.Int).Add(parent.Td, block.Difficulty())
+
+	batch := chainMan.db.NewBatch()
+	chainMan.write(batch, block)
+	batch.Write()
+
+	return block
+}
+
+func TestReorg(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	var eventMux event.TypeMux
+	chainMan := NewChainManager(db, &eventMux)
+	genesis := chainMan.Genesis()
+
+	key, _ := crypto.GenerateKey()
+	txs := make(types.Transactions, 3)
+	for i := range txs {
+		txs[i] = types.NewTransactionMessage(make([]byte, 20), big.NewInt(100), big.NewInt(21000), big.NewInt(1), nil)
+		txs[i].SetNonce(uint64(i))
+		txs[i].SignECDSA(key)
+	}
+
+	// genesis -> a1 (tx0, tx1)
+	a1 := newTestBlock(chainMan, genesis, 1, types.Transactions{txs[0], txs[1]})
+	batch := db.NewBatch()
+	chainMan.insert(batch, a1)
+	batch.Write()
+
+	// genesis -> b1 (tx1) -> b2 (tx2)
+	b1 := newTestBlock(chainMan, genesis, 2, types.Transactions{txs[1]})
+	b2 := newTestBlock(chainMan, b1, 2, types.Transactions{txs[2]})
+
+	batch = db.NewBatch()
+	events := chainMan.reorg(batch, a1, b2)
+	chainMan.insert(batch, b2)
+	batch.Write()
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d: %v", len(events), events)
+	}
+	if ev, ok := events[0].(ChainSideEvent); !ok || !bytes.Equal(ev.Block.Hash(), a1.Hash()) {
+		t.Errorf("expected side event for a1, got %v", events[0])
+	}
+	if ev, ok := events[1].(RemovedTransactionsEvent); !ok || len(ev.Txs) != 1 || !bytes.Equal(ev.Txs[0].Hash(), txs[0].Hash()) {
+		t.Errorf("expected tx0 to be removed, got %v", events[1])
+	}
+
+	for i, block := range (types.Blocks{genesis, b1, b2}) {
+		if b := chainMan.GetBlockByNumber(uint64(i)); b == nil || !bytes.Equal(b.Hash(), block.Hash()) {
+			t.Errorf("block #%d isn't canonical", i)
+		}
+	}
+
+	if tx, _, _ := chainMan.GetTransaction(txs[0].Hash()); tx != nil {
+		t.Error("expected dropped transaction to be removed from the lookup")
+	}
+	if _, hash, _ := chainMan.GetTransaction(txs[1].Hash()); !bytes.Equal(hash, b1.Hash()) {
+		t.Errorf("expected tx1 to point to b1, got %x", hash)
+	}
+	if _, hash, _ := chainMan.GetTransaction(txs[2].Hash()); !bytes.Equal(hash, b2.Hash()) {
+		t.Errorf("expected tx2 to point to b2, got %x", hash)
+	}
+}
+
+func TestChainExport(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	chain, err := loadChain("valid1", t)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+
+	var eventMux event.TypeMux
+	chainMan := NewChainManager(db, &eventMux)
+	txPool := NewTxPool(&eventMux, chainMan)
+	blockMan := NewBlockProcessor(db, txPool, chainMan, &eventMux)
+	chainMan.SetProcessor(blockMan)
+
+	if err := chainMan.InsertChain(chain); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := chainMan.ExportN(&buf, 10, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := rlp.NewStream(&buf)
+	for number := uint64(10); number <= 20; number++ {
+		var block types.Block
+		if err := stream.Decode(&block); err != nil {
+			t.Fatalf("block #%d: %v", number, err)
+		}
+		if !bytes.Equal(block.Hash(), chain[number].Hash()) {
+			t.Errorf("block #%d: hash mismatch", number)
+		}
+	}
+	if err := stream.Decode(new(types.Block)); err != io.EOF {
+		t.Errorf("expected EOF after the last block, got %v", err)
+	}
+
+	if err := chainMan.ExportN(&buf, 0, uint64(len(chain))); err == nil {
+		t.Error("expected error exporting beyond the head")
+	}
+}
+
+func TestSetHead(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	chain, err := loadChain("valid1", t)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+
+	var eventMux event.TypeMux
+	chainMan := NewChainManager(db, &eventMux)
+	txPool := NewTxPool(&eventMux, chainMan)
+	blockMan := NewBlockProcessor(db, txPool, chainMan, &eventMux)
+	chainMan.SetProcessor(blockMan)
+
+	if err := chainMan.InsertChain(chain); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := chainMan.SetHead(uint64(len(chain))); err == nil {
+		t.Error("expected error rewinding to an unknown block")
+	}
+
+	const head = 20
+	if err := chainMan.SetHead(head); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(chainMan.CurrentBlock().Hash(), chain[head].Hash()) {
+		t.Errorf("head mismatch: got #%d", chainMan.CurrentBlock().NumberU64())
+	}
+	if chainMan.Td().Cmp(chain[head].Td) != 0 {
+		t.Errorf("td mismatch: got %v, want %v", chainMan.Td(), chain[head].Td)
+	}
+	if b := chainMan.GetBlockByNumber(head + 1); b != nil {
+		t.Errorf("expected no block after the head, got #%d", b.NumberU64())
+	}
+	if chainMan.HasBlock(chain[head+1].Hash()) {
+		t.Error("expected blocks above the head to be removed")
+	}
+
+	// The removed blocks can be imported again
+	if err := chainMan.InsertChain(chain[head+1:]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chainMan.CurrentBlock().Hash(), chain[len(chain)-1].Hash()) {
+		t.Errorf("head mismatch after re-import: got #%d", chainMan.CurrentBlock().NumberU64())
+	}
+}
+
+func TestCustomGenesis(t *testing.T) {
+	spec := `{
+		"nonce": "0x0000000000000042",
+		"timestamp": "0x54e34e8e",
+		"extraData": "0x11bbe8db4e347b4e8c937c1c8370e4b5ed33adb3db69cbdb7a38e1e50b1b82fa",
+		"gasLimit": "3141592",
+		"difficulty": "0x400",
+		"alloc": {
+			"0x0000000000000000000000000000000000000001": {"balance": "1000"},
+			"0000000000000000000000000000000000000002": {"balance": "0x10", "code": "0x6001", "storage": {"0x01": "0x2a"}}
+		}
+	}`
+	genesis, err := ReadGenesis(strings.NewReader(spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := ethdb.NewMemDatabase()
+	block, err := genesis.Block(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.GasLimit().Cmp(big.NewInt(3141592)) != 0 || block.Difficulty().Cmp(big.NewInt(1024)) != 0 || block.Time() != 0x54e34e8e {
+		t.Fatalf("header mismatch: gas limit %v, difficulty %v, time %d", block.GasLimit(), block.Difficulty(), block.Time())
+	}
+
+	var eventMux event.TypeMux
+	chainMan, err := NewChainManagerWithGenesis(db, block, nil, &eventMux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chainMan.Genesis().Hash(), block.Hash()) || !bytes.Equal(chainMan.CurrentBlock().Hash(), block.Hash()) {
+		t.Error("genesis wasn't written as the head of the chain")
+	}
+
+	statedb := chainMan.State()
+	if balance := statedb.GetBalance(ethutil.Hex2Bytes("0000000000000000000000000000000000000001")); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("balance mismatch: got %v, want 1000", balance)
+	}
+	addr := ethutil.Hex2Bytes("0000000000000000000000000000000000000002")
+	if code := statedb.GetCode(addr); !bytes.Equal(code, []byte{0x60, 0x01}) {
+		t.Errorf("code mismatch: got %x", code)
+	}
+	if value := ethutil.BigD(statedb.GetState(addr, []byte{1})); value.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("storage mismatch: got %v, want 42", value)
+	}
+
+	// Restarting with the same genesis must succeed, a different one must not
+	if _, err := NewChainManagerWithGenesis(db, block, nil, &eventMux); err != nil {
+		t.Error("restart with the same genesis failed:", err)
+	}
+	other := GenesisBlock(db)
+	if _, err := NewChainManagerWithGenesis(db, other, nil, &eventMux); err == nil {
+		t.Error("expected an error for a mismatching genesis")
+	}
+	if data, _ := db.Get(other.Root()); len(data) > 0 {
+		t.Error("the state of the mismatching genesis was written")
+	}
+}
+
+func TestChainConfigRules(t *testing.T) {
+	config := DefaultChainConfig()
+	fork := *config.Rules[0]
+	fork.Block = big.NewInt(2)
+	fork.BlockReward = big.NewInt(5e+18)
+	fork.DurationLimit = 5
+	fork.MinimumDifficulty = big.NewInt(1024)
+	config.Rules = append(config.Rules, &fork)
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if rules := config.RulesAt(big.NewInt(1)); rules.BlockReward.Cmp(BlockReward) != 0 {
+		t.Errorf("block 1: reward %v, want %v", rules.BlockReward, BlockReward)
+	}
+	if rules := config.RulesAt(big.NewInt(2)); rules != &fork {
+		t.Error("block 2: fork rules not active")
+	}
+
+	db, _ := ethdb.NewMemDatabase()
+	var eventMux event.TypeMux
+	chainMan, err := NewChainManagerWithGenesis(db, GenesisBlock(db), config, &eventMux)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A block taking 10 seconds raises the difficulty under the default rules
+	// but lowers it after the fork, though never below the minimum
+	parent := newTestBlock(chainMan, chainMan.Genesis(), 1, nil)
+	parent.Header().Difficulty = big.NewInt(1024)
+	block := newTestBlock(chainMan, parent, 1, nil)
+	block.Header().Time = parent.Header().Time + 10
+	if diff := config.CalcDifficulty(block, parent); diff.Cmp(big.NewInt(1024)) != 0 {
+		t.Errorf("difficulty after fork: got %v, want 1024", diff)
+	}
+	block.Header().Number = big.NewInt(1)
+	if diff := config.CalcDifficulty(block, parent); diff.Cmp(big.NewInt(1025)) != 0 {
+		t.Errorf("difficulty before fork: got %v, want 1025", diff)
+	}
+
+	config.Rules[1].Block = big.NewInt(0)
+	if err := config.Validate(); err == nil {
+		t.Error("expected an error for misordered rules")
+	}
+}
+
+// runCode runs code in the environment of a block with the given number on
+// chainMan and returns the gas it used
+func runCode(chainMan *ChainManager, number int64, code []byte) (*big.Int, error) {
+	key, _ := crypto.GenerateKey()
+	tx := types.NewTransactionMessage(make([]byte, 20), ethutil.Big0, big.NewInt(100000), ethutil.Big0, nil)
+	tx.SignECDSA(key)
+
+	genesis := chainMan.Genesis()
+	block := types.NewBlock(genesis.Hash(), make([]byte, 20), genesis.Root(), genesis.Difficulty(), nil, "")
+	block.Header().Number = big.NewInt(number)
+
+	statedb := chainMan.State()
+	env := NewEnv(statedb, chainMan, tx, block)
+	caller, contract := statedb.GetOrNewStateObject([]byte("caller")), statedb.GetOrNewStateObject([]byte("contract"))
+
+	gas := big.NewInt(100000)
+	_, err := vm.New(env, vm.DebugVmTy).Run(contract, caller, code, ethutil.Big0, gas, ethutil.Big0, nil)
+
+	return gas.Sub(big.NewInt(100000), gas), err
+}
+
+func TestChainConfigVMRules(t *testing.T) {
+	// From block 2 on SLOAD costs 200 and NUMBER is removed
+	config := DefaultChainConfig()
+	fork := *config.Rules[0]
+	fork.Block = big.NewInt(2)
+	gasTable, jumpTable := *fork.GasTable, *fork.JumpTable
+	gasTable.SLoad = big.NewInt(200)
+	jumpTable.Disable(vm.NUMBER)
+	fork.GasTable, fork.JumpTable = &gasTable, &jumpTable
+	config.Rules = append(config.Rules, &fork)
+
+	db, _ := ethdb.NewMemDatabase()
+	var eventMux event.TypeMux
+	chainMan, err := NewChainManagerWithGenesis(db, GenesisBlock(db), config, &eventMux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A chain on the default rules in the same process
+	defaultDb, _ := ethdb.NewMemDatabase()
+	defaultChain := NewChainManager(defaultDb, &eventMux)
+
+	// PUSH1 0x00 SLOAD STOP
+	sload := []byte{byte(vm.PUSH1), 0x00, byte(vm.SLOAD), byte(vm.STOP)}
+	// NUMBER STOP
+	number := []byte{byte(vm.NUMBER), byte(vm.STOP)}
+
+	var (
+		wg                  sync.WaitGroup
+		before, after, dflt *big.Int
+		disabled, enabled   error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		before, _ = runCode(chainMan, 1, sload)
+		after, _ = runCode(chainMan, 2, sload)
+		_, disabled = runCode(chainMan, 2, number)
+	}()
+	go func() {
+		defer wg.Done()
+		dflt, _ = runCode(defaultChain, 2, sload)
+		_, enabled = runCode(defaultChain, 2, number)
+	}()
+	wg.Wait()
+
+	if diff := new(big.Int).Sub(after, before); diff.Cmp(big.NewInt(180)) != 0 {
+		t.Errorf("SLOAD: block 2 used %v gas, block 1 %v, want a difference of 180", after, before)
+	}
+	if dflt.Cmp(before) != 0 {
+		t.Errorf("SLOAD: default rules used %v gas at block 2, want %v", dflt, before)
+	}
+	if disabled == nil {
+		t.Error("expected NUMBER to be rejected after the fork")
+	}
+	if enabled != nil {
+		t.Errorf("expected NUMBER to run under the default rules, got %v", enabled)
+	}
+}
+
+func TestSecureTrieChain(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.Sha3(crypto.FromECDSAPub(&key.PublicKey)[1:])[12:]
+	genesis := &Genesis{GasLimit: "1000000", Difficulty: "1", Alloc: map[string]GenesisAccount{
+		ethutil.Bytes2Hex(from): {Balance: "1000000000000000000"},
+	}}
+
+	config := DefaultChainConfig()
+	config.SecureTrie = true
+
+	db, _ := ethdb.NewMemDatabase()
+	block, err := genesis.Block(db, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainDb, _ := ethdb.NewMemDatabase()
+	if plain, _ := genesis.Block(plainDb, nil); bytes.Equal(block.Root(), plain.Root()) {
+		t.Error("secure genesis has the state root of the plain genesis")
+	}
+
+	var eventMux event.TypeMux
+	chainMan, err := NewChainManagerWithGenesis(db, block, config, &eventMux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainMan.SetProcessor(NewBlockProcessor(db, NewTxPool(&eventMux, chainMan), chainMan, &eventMux))
+
+	to := ethutil.Hex2Bytes("0000000000000000000000000000000000000001")
+	tx := types.NewTransactionMessage(to, big.NewInt(10), big.NewInt(100000), big.NewInt(1), nil)
+	tx.SignECDSA(key)
+	if _, err := InsertTestBlock(chainMan, make([]byte, 20), types.Transactions{tx}); err != nil {
+		t.Fatal(err)
+	}
+
+	statedb := chainMan.State()
+	if balance := statedb.GetBalance(to); balance.Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("balance mismatch: got %v, want 10", balance)
+	}
+	if nonce := statedb.GetNonce(from); nonce != 1 {
+		t.Errorf("nonce mismatch: got %d, want 1", nonce)
+	}
+	// The accounts are keyed by their hash, the plain state can't find them
+	if state.New(chainMan.CurrentBlock().Root(), db).GetStateObject(from) != nil {
+		t.Error("found the sender in the plain state")
+	}
+}
+
+// newPrunedChain creates a chain on genesis whose state is written through a
+// pruner keeping the state of the last retain blocks
+func newPrunedChain(t *testing.T, genesis *Genesis, retain uint64) (*ChainManager, *state.Pruner) {
+	db, _ := ethdb.NewMemDatabase()
+	pruner := state.NewPruner(db, retain, nil)
+	chainMan, err := NewTestChain(db, genesis, pruner, new(event.TypeMux))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return chainMan, pruner
+}
+
+func TestPrunedState(t *testing.T) {
+	chainMan, pruner := newPrunedChain(t, &Genesis{GasLimit: "1000000", Difficulty: "1"}, 2)
+	for i := 1; i <= 5; i++ {
+		coinbase := make([]byte, 20)
+		coinbase[19] = byte(i)
+		if _, err := InsertTestBlock(chainMan, coinbase, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Sweeps at #2 and #4 keep the state of #3 and later
+	if oldest := pruner.Oldest(); oldest != 3 {
+		t.Fatalf("oldest kept block mismatch: got #%d, want #3", oldest)
+	}
+
+	if _, err := chainMan.StateAt(chainMan.GetBlockByNumber(1).Root()); err == nil {
+		t.Error("expected an error opening the pruned state of #1")
+	}
+	for number := uint64(3); number <= 5; number++ {
+		if _, err := chainMan.StateAt(chainMan.GetBlockByNumber(number).Root()); err != nil {
+			t.Errorf("#%d: %v", number, err)
+		}
+	}
+
+	if err := chainMan.SetHead(2); err == nil {
+		t.Error("expected an error rewinding to the pruned state of #2")
+	}
+	if chainMan.CurrentBlock().NumberU64() != 5 {
+		t.Errorf("head moved to #%d by a refused rewind", chainMan.CurrentBlock().NumberU64())
+	}
+	if err := chainMan.SetHead(3); err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain grows again from the rewound head, sweeping at #6
+	for i := 0; i < 3; i++ {
+		if _, err := InsertTestBlock(chainMan, make([]byte, 20), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if oldest := pruner.Oldest(); oldest != 5 {
+		t.Errorf("oldest kept block mismatch after the rewind: got #%d, want #5", oldest)
+	}
+	if _, err := chainMan.StateAt(chainMan.CurrentBlock().Root()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPrunedChainState(t *testing.T) {
+	const retain, blocks = 3, 10
+
+	key, _ := crypto.GenerateKey()
+	from := crypto.Sha3(crypto.FromECDSAPub(&key.PublicKey)[1:])[12:]
+	// The counter stores the number of the block calling it
+	counter := ethutil.Hex2Bytes("00000000000000000000000000000000000000c0")
+	genesis := &Genesis{GasLimit: "1000000", Difficulty: "1", Alloc: map[string]GenesisAccount{
+		ethutil.Bytes2Hex(from):    {Balance: "1000000000000000000"},
+		ethutil.Bytes2Hex(counter): {Balance: "0", Code: "0x43600055"},
+	}}
+
+	chainMan, _ := newPrunedChain(t, genesis, retain)
+	archive, err := benchChainManager(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every block calls the counter and creates a contract storing and
+	// returning the number of the block
+	var chain types.Blocks
+	for i := 1; i <= blocks; i++ {
+		call := types.NewTransactionMessage(counter, ethutil.Big0, big.NewInt(100000), big.NewInt(1), nil)
+		call.SetNonce(uint64(2 * (i - 1)))
+		call.SignECDSA(key)
+		create := types.NewContractCreationTx(ethutil.Big0, big.NewInt(100000), big.NewInt(1), []byte{
+			0x60, byte(i), 0x60, 0x00, 0x55, // SSTORE(0, i)
+			0x60, byte(i), 0x60, 0x00, 0x53, // MSTORE8(0, i)
+			0x60, 0x01, 0x60, 0x00, 0xf3, // RETURN(0, 1)
+		})
+		create.SetNonce(uint64(2*(i-1) + 1))
+		create.SignECDSA(key)
+
+		block, err := InsertTestBlock(chainMan, make([]byte, 20), types.Transactions{call, create})
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, block)
+	}
+	if err := archive.InsertChain(chain); err != nil {
+		t.Fatal(err)
+	}
+
+	// The states of the retained blocks match the archive, down to the
+	// storage and code of every contract
+	for number := blocks - retain + 1; number <= blocks; number++ {
+		root := chain[number-1].Root()
+		statedb, err := chainMan.StateAt(root)
+		if err != nil {
+			t.Fatalf("#%d: %v", number, err)
+		}
+		archived, _ := archive.StateAt(root)
+		slot := func(addr []byte) uint64 {
+			if object := statedb.GetStateObject(addr); object != nil {
+				return object.GetStorage(ethutil.Big0).Uint()
+			}
+			return 0
+		}
+		if !bytes.Equal(statedb.Dump(), archived.Dump()) {
+			t.Errorf("#%d: state mismatch:\n%s\nwant\n%s", number, statedb.Dump(), archived.Dump())
+		}
+
+		if stored := slot(counter); stored != uint64(number) {
+			t.Errorf("#%d: counter mismatch: got %v", number, stored)
+		}
+		for i := 1; i <= number; i++ {
+			contract := crypto.CreateAddress(from, uint64(2*(i-1)+1))
+			if code := statedb.GetCode(contract); !bytes.Equal(code, []byte{byte(i)}) {
+				t.Errorf("#%d: code of contract %d mismatch: got %x", number, i, code)
+			}
+			if stored := slot(contract); stored != uint64(i) {
+				t.Errorf("#%d: storage of contract %d mismatch: got %v", number, i, stored)
+			}
+		}
+	}
+	if _, err := chainMan.StateAt(chain[0].Root()); err == nil {
+		t.Error("expected the state of #1 to be pruned")
+	}
+}
+
+// rewindingProcessor rewinds the chain after processing a block, as a
+// concurrent SetHead would
+type rewindingProcessor struct {
+	types.BlockProcessor
+	rewind func()
+}
+
+func (self *rewindingProcessor) Process(block *types.Block, batch ethutil.Batch) (*big.Int, state.Messages, error) {
+	td, messages, err := self.BlockProcessor.Process(block, batch)
+	self.rewind()
+
+	return td, messages, err
+}
+
+func TestSetHeadDuringInsert(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	chain, err := loadChain("valid1", t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var eventMux event.TypeMux
+	chainMan := NewChainManager(db, &eventMux)
+	blockMan := NewBlockProcessor(db, NewTxPool(&eventMux, chainMan), chainMan, &eventMux)
+	chainMan.SetProcessor(blockMan)
+	if err := chainMan.InsertChain(chain[:10]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The parent of the processed block is deleted before it's written
+	chainMan.SetProcessor(&rewindingProcessor{blockMan, func() {
+		if err := chainMan.SetHead(5); err != nil {
+			t.Error(err)
+		}
+	}})
+	if err := chainMan.InsertChain(chain[10:11]); !IsParentErr(err) {
+		t.Errorf("expected a parent error, got %v", err)
+	}
+	if head := chainMan.CurrentBlock(); !bytes.Equal(head.Hash(), chain[5].Hash()) {
+		t.Errorf("head mismatch: got #%d, want #5", head.NumberU64())
+	}
+	if chainMan.HasBlock(chain[10].Hash()) {
+		t.Error("the block was written on top of the deleted parent")
+	}
+}
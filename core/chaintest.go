@@ -0,0 +1,60 @@
+package core
+
+import (
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethutil"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/state"
+)
+
+// NewTestChain creates a chain in db starting at the genesis block of
+// genesis, with a block processor and transaction pool posting to eventMux.
+// The state of processed blocks is written through pruner unless it's nil.
+// It's meant for tests, blocks are added with InsertTestBlock.
+func NewTestChain(db ethutil.Database, genesis *Genesis, pruner *state.Pruner, eventMux *event.TypeMux) (*ChainManager, error) {
+	block, err := genesis.Block(db, nil)
+	if err != nil {
+		return nil, err
+	}
+	chainMan, err := NewChainManagerWithGenesis(db, block, nil, eventMux)
+	if err != nil {
+		return nil, err
+	}
+
+	stateDb := db
+	if pruner != nil {
+		chainMan.SetPruner(pruner)
+		stateDb = pruner
+	}
+	chainMan.SetProcessor(NewBlockProcessor(stateDb, NewTxPool(eventMux, chainMan), chainMan, eventMux))
+
+	return chainMan, nil
+}
+
+// InsertTestBlock mines a block holding txs on top of the current head of a
+// chain created by NewTestChain and inserts it
+func InsertTestBlock(chainMan *ChainManager, coinbase []byte, txs types.Transactions) (*types.Block, error) {
+	processor := chainMan.processor.(*BlockProcessor)
+	parent := chainMan.CurrentBlock()
+	block := chainMan.NewBlock(coinbase)
+	statedb := chainMan.State()
+	cb := statedb.GetOrNewStateObject(coinbase)
+	cb.SetGasPool(block.GasLimit())
+
+	receipts, handled, _, _, err := processor.ApplyTransactions(cb, statedb, block, txs, true)
+	if err != nil {
+		return nil, err
+	}
+	block.SetTransactions(handled)
+	block.SetReceipts(receipts)
+	processor.AccumelateRewards(statedb, block, parent)
+	statedb.Update(ethutil.Big0)
+	block.SetRoot(statedb.Root())
+	block.Header().Nonce = make([]byte, 32)
+
+	if err := chainMan.InsertChain(types.Blocks{block}); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
@@ -98,6 +98,46 @@ func IsNonceErr(err error) bool {
 	return ok
 }
 
+// Transaction validation error, the sender can't pay for the gas and value
+type InsufficientFundsErr struct {
+	Message   string
+	Has, Need *big.Int
+}
+
+func (err *InsufficientFundsErr) Error() string {
+	return err.Message
+}
+
+func InsufficientFundsError(has, need *big.Int) *InsufficientFundsErr {
+	return &InsufficientFundsErr{Message: fmt.Sprintf("Insufficient funds. Has %v, needs %v", has, need), Has: has, Need: need}
+}
+
+func IsInsufficientFundsErr(err error) bool {
+	_, ok := err.(*InsufficientFundsErr)
+
+	return ok
+}
+
+// Transaction validation error, the gas limit doesn't cover the intrinsic gas
+type IntrinsicGasErr struct {
+	Message  string
+	Is, Need *big.Int
+}
+
+func (err *IntrinsicGasErr) Error() string {
+	return err.Message
+}
+
+func IntrinsicGasError(is, need *big.Int) *IntrinsicGasErr {
+	return &IntrinsicGasErr{Message: fmt.Sprintf("Intrinsic gas too low. Is %v, needs %v", is, need), Is: is, Need: need}
+}
+
+func IsIntrinsicGasErr(err error) bool {
+	_, ok := err.(*IntrinsicGasErr)
+
+	return ok
+}
+
 type OutOfGasErr struct {
 	Message string
 }
@@ -13,3 +13,14 @@ type NewBlockEvent struct{ Block *types.Block }
 
 // NewMinedBlockEvent is posted when a block has been imported.
 type NewMinedBlockEvent struct{ Block *types.Block }
+
+// ChainHeadEvent is posted when a block becomes the new head of the canonical chain.
+type ChainHeadEvent struct{ Block *types.Block }
+
+// ChainSideEvent is posted when a block is imported that isn't part of the canonical
+// chain or when a block is dropped from the canonical chain during a reorganisation.
+type ChainSideEvent struct{ Block *types.Block }
+
+// RemovedTransactionsEvent is posted when a reorganisation drops transactions
+// from the canonical chain.
+type RemovedTransactionsEvent struct{ Txs types.Transactions }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethutil"
 	"github.com/ethereum/go-ethereum/state"
 	"github.com/ethereum/go-ethereum/vm"
 )
@@ -28,10 +29,17 @@ func (self *Execution) Call(codeAddr []byte, caller vm.ContextRef) ([]byte, erro
 	// Retrieve the executing code
 	code := self.env.State().GetCode(codeAddr)
 
-	return self.exec(code, codeAddr, caller)
+	return self.exec(vm.CALL, code, codeAddr, caller)
 }
 
-func (self *Execution) exec(code, contextAddr []byte, caller vm.ContextRef) (ret []byte, err error) {
+// CallCode runs the code at codeAddr in the context of the execution's address
+func (self *Execution) CallCode(codeAddr []byte, caller vm.ContextRef) ([]byte, error) {
+	code := self.env.State().GetCode(codeAddr)
+
+	return self.exec(vm.CALLCODE, code, codeAddr, caller)
+}
+
+func (self *Execution) exec(typ vm.OpCode, code, contextAddr []byte, caller vm.ContextRef) (ret []byte, err error) {
 	env := self.env
 	evm := vm.New(env, vm.DebugVmTy)
 
@@ -41,37 +49,70 @@ func (self *Execution) exec(code, contextAddr []byte, caller vm.ContextRef) (ret
 		return nil, vm.DepthError{}
 	}
 
-	vsnapshot := env.State().Copy()
+	vsnapshot := env.State().Snapshot()
 	if len(self.address) == 0 {
 		// Generate a new address
 		nonce := env.State().GetNonce(caller.Address())
 		self.address = crypto.CreateAddress(caller.Address(), nonce)
 		env.State().SetNonce(caller.Address(), nonce+1)
 	}
+	if typ == vm.CREATE {
+		contextAddr = self.address
+	}
+
+	// The outermost call is started and ended on the tracer, nested ones are
+	// entered and exited
+	var (
+		tracer = env.Tracer()
+		depth  = env.FrameDepth()
+	)
+	if tracer != nil {
+		if depth == 0 {
+			tracer.CaptureStart(caller.Address(), contextAddr, typ == vm.CREATE, self.input, self.Gas, self.value)
+		} else {
+			tracer.CaptureEnter(typ, caller.Address(), contextAddr, self.input, self.Gas, self.value)
+		}
+	}
+	captureEnd := func(ret []byte, gasUsed *big.Int, err error) {
+		if tracer == nil {
+			return
+		}
+		if depth == 0 {
+			tracer.CaptureEnd(ret, gasUsed, err)
+		} else {
+			tracer.CaptureExit(ret, gasUsed, err)
+		}
+	}
 
 	from, to := env.State().GetStateObject(caller.Address()), env.State().GetOrNewStateObject(self.address)
 	err = env.Transfer(from, to, self.value)
 	if err != nil {
-		env.State().Set(vsnapshot)
+		env.State().RevertToSnapshot(vsnapshot)
 
 		caller.ReturnGas(self.Gas, self.price)
 
-		return nil, fmt.Errorf("insufficient funds to transfer value. Req %v, has %v", self.value, from.Balance())
+		err = fmt.Errorf("insufficient funds to transfer value. Req %v, has %v", self.value, from.Balance())
+		captureEnd(nil, ethutil.Big0, err)
+
+		return nil, err
 	}
 
-	snapshot := env.State().Copy()
+	snapshot := env.State().Snapshot()
 	start := time.Now()
+	gas := new(big.Int).Set(self.Gas)
 	ret, err = evm.Run(to, caller, code, self.value, self.Gas, self.price, self.input)
 	if err != nil {
-		env.State().Set(snapshot)
+		env.State().RevertToSnapshot(snapshot)
 	}
 	chainlogger.Debugf("vm took %v\n", time.Since(start))
 
+	captureEnd(ret, gas.Sub(gas, self.Gas), err)
+
 	return
 }
 
 func (self *Execution) Create(caller vm.ContextRef) (ret []byte, err error, account *state.StateObject) {
-	ret, err = self.exec(self.input, nil, caller)
+	ret, err = self.exec(vm.CREATE, self.input, nil, caller)
 	account = self.env.State().GetStateObject(self.address)
 
 	return
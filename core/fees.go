@@ -4,4 +4,5 @@ import (
 	"math/big"
 )
 
+// BlockReward is the block reward of the default chain configuration
 var BlockReward *big.Int = big.NewInt(1.5e+18)
@@ -1,12 +1,16 @@
 package core
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethutil"
-	"github.com/ethereum/go-ethereum/state"
 )
 
 /*
@@ -19,20 +23,29 @@ var ZeroHash512 = make([]byte, 64)
 var EmptyShaList = crypto.Sha3(ethutil.Encode([]interface{}{}))
 var EmptyListRoot = crypto.Sha3(ethutil.Encode(""))
 
-func GenesisBlock(db ethutil.Database) *types.Block {
-	genesis := types.NewBlock(ZeroHash256, ZeroHash160, nil, big.NewInt(131072), crypto.Sha3(big.NewInt(42).Bytes()), "")
-	genesis.Header().Number = ethutil.Big0
-	genesis.Header().GasLimit = big.NewInt(1000000)
-	genesis.Header().GasUsed = ethutil.Big0
-	genesis.Header().Time = 0
-	genesis.Td = ethutil.Big0
+// GenesisAccount is an account in the initial allocation of a genesis
+// specification. Storage maps hex encoded keys to hex encoded values.
+type GenesisAccount struct {
+	Balance string            `json:"balance"`
+	Code    string            `json:"code"`
+	Storage map[string]string `json:"storage"`
+}
 
-	genesis.SetUncles([]*types.Header{})
-	genesis.SetTransactions(types.Transactions{})
-	genesis.SetReceipts(types.Receipts{})
+// Genesis is the JSON specification of a genesis block. Numbers may be given
+// in decimal or as 0x prefixed hex, byte strings are hex encoded.
+type Genesis struct {
+	Nonce      string                    `json:"nonce"`
+	Timestamp  string                    `json:"timestamp"`
+	ExtraData  string                    `json:"extraData"`
+	GasLimit   string                    `json:"gasLimit"`
+	Difficulty string                    `json:"difficulty"`
+	Coinbase   string                    `json:"coinbase"`
+	Alloc      map[string]GenesisAccount `json:"alloc"`
+}
 
-	statedb := state.New(genesis.Root(), db)
-	//statedb := state.New(genesis.Trie())
+// DefaultGenesis returns the specification of the default genesis block
+func DefaultGenesis() *Genesis {
+	alloc := make(map[string]GenesisAccount)
 	for _, addr := range []string{
 		"51ba59315b3a95761d0863b05ccc7a7f54703d99",
 		"e4157b34ea9615cfbde6b4fda419828124b70c78",
@@ -43,13 +56,149 @@ func GenesisBlock(db ethutil.Database) *types.Block {
 		"e6716f9544a56c530d868e4bfbacb172315bdead",
 		"1a26338f0d905e295fccb71fa9ea849ffa12aaf4",
 	} {
-		codedAddr := ethutil.Hex2Bytes(addr)
-		account := statedb.GetAccount(codedAddr)
-		account.SetBalance(ethutil.Big("1606938044258990275541962092341162602522202993782792835301376")) //ethutil.BigPow(2, 200)
-		statedb.UpdateStateObject(account)
+		alloc[addr] = GenesisAccount{Balance: "1606938044258990275541962092341162602522202993782792835301376"} //ethutil.BigPow(2, 200)
+	}
+
+	return &Genesis{
+		Nonce:      ethutil.Bytes2Hex(crypto.Sha3(big.NewInt(42).Bytes())),
+		Timestamp:  "0",
+		GasLimit:   "1000000",
+		Difficulty: "131072",
+		Alloc:      alloc,
+	}
+}
+
+// ReadGenesis decodes a JSON genesis specification from r
+func ReadGenesis(r io.Reader) (*Genesis, error) {
+	genesis := new(Genesis)
+	if err := json.NewDecoder(r).Decode(genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis file: %v", err)
+	}
+
+	return genesis, nil
+}
+
+// Block creates the genesis block described by the specification and writes
+// its initial state to db in the trie mode of config, the default if nil. The
+// state is built in memory and only written if db holds no chain yet. A chain
+// started from this genesis already holds it, a chain started from another one
+// is rejected by the chain manager without leaving the state behind.
+func (self *Genesis) Block(db ethutil.Database, config *ChainConfig) (*types.Block, error) {
+	if config == nil {
+		config = DefaultChainConfig()
+	}
+
+	nonce, err := parseGenesisBytes(self.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("genesis nonce: %v", err)
+	}
+	extra, err := parseGenesisBytes(self.ExtraData)
+	if err != nil {
+		return nil, fmt.Errorf("genesis extraData: %v", err)
+	}
+	coinbase, err := parseGenesisBytes(self.Coinbase)
+	if err != nil {
+		return nil, fmt.Errorf("genesis coinbase: %v", err)
+	}
+	if len(coinbase) == 0 {
+		coinbase = ZeroHash160
+	}
+	timestamp, err := parseGenesisBig(self.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("genesis timestamp: %v", err)
+	}
+	gasLimit, err := parseGenesisBig(self.GasLimit)
+	if err != nil {
+		return nil, fmt.Errorf("genesis gasLimit: %v", err)
+	}
+	difficulty, err := parseGenesisBig(self.Difficulty)
+	if err != nil {
+		return nil, fmt.Errorf("genesis difficulty: %v", err)
+	}
+
+	genesis := types.NewBlock(ZeroHash256, coinbase, nil, difficulty, nonce, string(extra))
+	genesis.Header().Number = ethutil.Big0
+	genesis.Header().GasLimit = gasLimit
+	genesis.Header().GasUsed = ethutil.Big0
+	genesis.Header().Time = timestamp.Uint64()
+	genesis.Td = ethutil.Big0
+
+	genesis.SetUncles([]*types.Header{})
+	genesis.SetTransactions(types.Transactions{})
+	genesis.SetReceipts(types.Receipts{})
+
+	statedb := config.NewState(genesis.Root(), db)
+	for addr, account := range self.Alloc {
+		codedAddr, err := parseGenesisBytes(addr)
+		if err != nil {
+			return nil, fmt.Errorf("genesis alloc %s: %v", addr, err)
+		}
+		balance, err := parseGenesisBig(account.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("genesis alloc %s balance: %v", addr, err)
+		}
+		code, err := parseGenesisBytes(account.Code)
+		if err != nil {
+			return nil, fmt.Errorf("genesis alloc %s code: %v", addr, err)
+		}
+
+		object := statedb.GetAccount(codedAddr)
+		object.SetBalance(balance)
+		if len(code) > 0 {
+			object.SetCode(code)
+		}
+		for k, v := range account.Storage {
+			key, err := parseGenesisBytes(k)
+			if err != nil {
+				return nil, fmt.Errorf("genesis alloc %s storage: %v", addr, err)
+			}
+			value, err := parseGenesisBytes(v)
+			if err != nil {
+				return nil, fmt.Errorf("genesis alloc %s storage: %v", addr, err)
+			}
+			object.SetState(key, ethutil.NewValue(value))
+		}
+		object.Sync()
+		statedb.UpdateStateObject(object)
 	}
-	statedb.Sync()
 	genesis.Header().Root = statedb.Root()
+	if data, _ := db.Get([]byte("LastBlock")); len(data) == 0 {
+		statedb.Sync()
+	}
+
+	return genesis, nil
+}
+
+func GenesisBlock(db ethutil.Database) *types.Block {
+	genesis, err := DefaultGenesis().Block(db, nil)
+	if err != nil {
+		panic(err)
+	}
 
 	return genesis
 }
+
+// parseGenesisBig parses a decimal or 0x prefixed hex number. The empty string
+// is treated as zero.
+func parseGenesisBig(s string) (*big.Int, error) {
+	if len(s) == 0 {
+		return new(big.Int), nil
+	}
+
+	num, ok := new(big.Int), false
+	if strings.HasPrefix(s, "0x") {
+		num, ok = num.SetString(s[2:], 16)
+	} else {
+		num, ok = num.SetString(s, 10)
+	}
+	if !ok || num.Sign() < 0 {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+
+	return num, nil
+}
+
+// parseGenesisBytes decodes a hex string with an optional 0x prefix
+func parseGenesisBytes(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// senderWorkers is the number of goroutines recovering transaction senders
+var senderWorkers = runtime.NumCPU()
+
+// recoverSenders recovers the senders of txs concurrently. The senders are
+// cached by the transactions so the serial processing that follows doesn't
+// spend its time in Ecrecover.
+func recoverSenders(txs types.Transactions) {
+	workers := senderWorkers
+	if len(txs) < workers {
+		workers = len(txs)
+	}
+	if workers <= 1 {
+		for _, tx := range txs {
+			tx.From()
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func(offset int) {
+			defer wg.Done()
+
+			for j := offset; j < len(txs); j += workers {
+				txs[j].From()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// recoverBlockSenders recovers the senders of all transactions in chain
+func recoverBlockSenders(chain types.Blocks) {
+	var txs types.Transactions
+	for _, block := range chain {
+		txs = append(txs, block.Transactions()...)
+	}
+	recoverSenders(txs)
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/big"
+	"runtime"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethutil"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestRecoverSenders(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 5)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	txs := make(types.Transactions, 50)
+	for i := range txs {
+		txs[i] = pricedTransaction(uint64(i), 1, keys[i%len(keys)])
+	}
+
+	recoverSenders(txs)
+	for i, tx := range txs {
+		addr := crypto.Sha3(crypto.FromECDSAPub(&keys[i%len(keys)].PublicKey)[1:])[12:]
+		if !bytes.Equal(tx.From(), addr) {
+			t.Errorf("tx %d: sender mismatch: got %x, want %x", i, tx.From(), addr)
+		}
+	}
+}
+
+// benchChain is a chain of blocks full of value transfers, generated once for
+// all import benchmarks
+var benchChain struct {
+	genesis *Genesis
+	blocks  [][]byte
+}
+
+func benchChainManager(genesis *Genesis) (*ChainManager, error) {
+	db, _ := ethdb.NewMemDatabase()
+	return NewTestChain(db, genesis, nil, new(event.TypeMux))
+}
+
+// makeBenchChain generates numBlocks blocks with txsPerBlock transactions
+// each, sent round robin by numKeys accounts
+func makeBenchChain(numKeys, numBlocks, txsPerBlock int) (*Genesis, [][]byte, error) {
+	keys := make([]*ecdsa.PrivateKey, numKeys)
+	genesis := &Genesis{GasLimit: "1000000000", Difficulty: "1", Alloc: make(map[string]GenesisAccount)}
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addr := crypto.Sha3(crypto.FromECDSAPub(&keys[i].PublicKey)[1:])[12:]
+		genesis.Alloc[ethutil.Bytes2Hex(addr)] = GenesisAccount{Balance: "1000000000000000000"}
+	}
+
+	chainMan, err := benchChainManager(genesis)
+	if err != nil {
+		return nil, nil, err
+	}
+	coinbase := make([]byte, 20)
+
+	var (
+		blocks [][]byte
+		nonces = make([]uint64, numKeys)
+	)
+	for i := 0; i < numBlocks; i++ {
+		txs := make(types.Transactions, txsPerBlock)
+		for j := range txs {
+			k := (i*txsPerBlock + j) % numKeys
+			txs[j] = types.NewTransactionMessage(coinbase, big.NewInt(1), big.NewInt(1000), big.NewInt(1), nil)
+			txs[j].SetNonce(nonces[k])
+			txs[j].SignECDSA(keys[k])
+			nonces[k]++
+		}
+		block, err := InsertTestBlock(chainMan, coinbase, txs)
+		if err != nil {
+			return nil, nil, err
+		}
+		blocks = append(blocks, ethutil.Encode(block))
+	}
+
+	return genesis, blocks, nil
+}
+
+func benchmarkInsertChain(b *testing.B, workers int) {
+	if benchChain.blocks == nil {
+		genesis, blocks, err := makeBenchChain(16, 4, 100)
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchChain.genesis, benchChain.blocks = genesis, blocks
+	}
+
+	defer func(n int) { senderWorkers = n }(senderWorkers)
+	senderWorkers = workers
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Import freshly decoded blocks so no sender is cached yet
+		b.StopTimer()
+		chainMan, err := benchChainManager(benchChain.genesis)
+		if err != nil {
+			b.Fatal(err)
+		}
+		chain := make(types.Blocks, len(benchChain.blocks))
+		for j, enc := range benchChain.blocks {
+			chain[j] = new(types.Block)
+			if err := rlp.Decode(bytes.NewReader(enc), chain[j]); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StartTimer()
+
+		if err := chainMan.InsertChain(chain); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInsertChainSerialSenders(b *testing.B) {
+	benchmarkInsertChain(b, 1)
+}
+
+func BenchmarkInsertChainParallelSenders(b *testing.B) {
+	benchmarkInsertChain(b, runtime.NumCPU())
+}
+
+func benchmarkRecoverSenders(b *testing.B, workers int) {
+	key, _ := crypto.GenerateKey()
+	encoded := make([][]byte, 200)
+	for i := range encoded {
+		encoded[i] = pricedTransaction(uint64(i), 1, key).RlpEncode()
+	}
+
+	defer func(n int) { senderWorkers = n }(senderWorkers)
+	senderWorkers = workers
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		txs := make(types.Transactions, len(encoded))
+		for j, enc := range encoded {
+			txs[j] = types.NewTransactionFromBytes(enc)
+		}
+		b.StartTimer()
+
+		recoverSenders(txs)
+	}
+}
+
+func BenchmarkRecoverSendersSerial(b *testing.B) {
+	benchmarkRecoverSenders(b, 1)
+}
+
+func BenchmarkRecoverSendersParallel(b *testing.B) {
+	benchmarkRecoverSenders(b, runtime.NumCPU())
+}
@@ -67,6 +67,26 @@ func MessageGasValue(msg Message) *big.Int {
 	return new(big.Int).Mul(msg.Gas(), msg.GasPrice())
 }
 
+// DataGas returns the gas charged for the payload of a transaction
+func DataGas(data []byte, gasTable *vm.GasTable) *big.Int {
+	var dgas int64
+	for _, byt := range data {
+		if byt != 0 {
+			dgas += gasTable.Data.Int64()
+		} else {
+			dgas += 1 // This is 1/5. If GasData changes this fails
+		}
+	}
+
+	return big.NewInt(dgas)
+}
+
+// IntrinsicGas returns the gas a transaction with the given payload costs
+// before any code is executed
+func IntrinsicGas(data []byte, gasTable *vm.GasTable) *big.Int {
+	return new(big.Int).Add(gasTable.Tx, DataGas(data, gasTable))
+}
+
 func NewStateTransition(env vm.Environment, msg Message, coinbase *state.StateObject) *StateTransition {
 	return &StateTransition{
 		coinbase:   coinbase.Address(),
@@ -164,23 +184,17 @@ func (self *StateTransition) TransitionState() (ret []byte, err error) {
 	defer self.RefundGas()
 
 	// Increment the nonce for the next transaction
-	sender.Nonce += 1
+	sender.SetNonce(sender.Nonce + 1)
+
+	gasTable := self.env.GasTable()
 
 	// Transaction gas
-	if err = self.UseGas(vm.GasTx); err != nil {
+	if err = self.UseGas(gasTable.Tx); err != nil {
 		return
 	}
 
 	// Pay data gas
-	var dgas int64
-	for _, byt := range self.data {
-		if byt != 0 {
-			dgas += vm.GasData.Int64()
-		} else {
-			dgas += 1 // This is 1/5. If GasData changes this fails
-		}
-	}
-	if err = self.UseGas(big.NewInt(dgas)); err != nil {
+	if err = self.UseGas(DataGas(self.data, gasTable)); err != nil {
 		return
 	}
 
@@ -191,7 +205,7 @@ func (self *StateTransition) TransitionState() (ret []byte, err error) {
 		ret, err, ref = vmenv.Create(sender, contract.Address(), self.msg.Data(), self.gas, self.gasPrice, self.value)
 		if err == nil {
 			dataGas := big.NewInt(int64(len(ret)))
-			dataGas.Mul(dataGas, vm.GasCreateByte)
+			dataGas.Mul(dataGas, gasTable.CreateByte)
 			if err := self.UseGas(dataGas); err == nil {
 				ref.SetCode(ret)
 			}
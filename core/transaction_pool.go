@@ -2,11 +2,14 @@ package core
 
 import (
 	"fmt"
+	"math/big"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethutil"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/logger"
+	"github.com/ethereum/go-ethereum/state"
 )
 
 var txplogger = logger.NewLogger("TXP")
@@ -20,42 +23,92 @@ type TxMsg struct {
 
 const (
 	minGasPrice = 1000000
+
+	// Default limits of the pool
+	maxPoolTxs      = 4096 // transactions held in total
+	maxAccountQueue = 64   // non executable transactions held per account
+
+	// Percentage by which a replacement has to raise the gas price of the
+	// pooled transaction with the same nonce
+	priceBump = 10
+
+	// Number of blocks a mined local transaction is remembered for, a
+	// reorganisation dropping it from the chain re-adds it as local
+	minedLocalsDepth = 128
 )
 
 type TxProcessor interface {
 	ProcessTransaction(tx *types.Transaction)
 }
 
-// The tx pool a thread safe transaction pool handler. In order to
-// guarantee a non blocking pool we use a queue channel which can be
-// independently read without needing access to the actual pool.
+// blockChain provides the pool with the head it validates transactions against
+type blockChain interface {
+	State() *state.StateDB
+	CurrentBlock() *types.Block
+	Config() *ChainConfig
+}
+
+// The tx pool a thread safe transaction pool handler. Transactions are kept
+// per sending account. "Pending" transactions can be executed on top of the
+// current state, "queued" ones wait for the transactions filling their nonce
+// gap. Queued transactions are promoted whenever a new head comes in.
 type TxPool struct {
+	mu sync.RWMutex
 	// Queueing channel for reading and writing incoming
 	// transactions to
 	queueChan chan *types.Transaction
 	// Quiting channel
 	quit chan bool
+	// Chain providing the head state for the account nonces and balances
+	chain blockChain
 	// The actual pool
-	//pool *list.List
-	txs map[string]*types.Transaction
+	all     map[string]*types.Transaction // every pooled transaction by hash
+	pending map[string]*txList            // executable transactions by sender
+	queue   map[string]*txList            // future transactions by sender
+
+	// Transactions submitted by the local node. They are never evicted and
+	// are written to the journal, if any, to survive restarts.
+	locals  map[string]bool
+	journal *txJournal
+	// Local transactions which were mined, by the head they were mined at
+	mined map[string]uint64
+
+	// Limits of the pool
+	maxTxs          int
+	maxAccountQueue int
 
 	SecondaryProcessor TxProcessor
 
 	subscribers []chan TxMsg
 
 	eventMux *event.TypeMux
+	events   event.Subscription
 }
 
-func NewTxPool(eventMux *event.TypeMux) *TxPool {
+func NewTxPool(eventMux *event.TypeMux, chain blockChain) *TxPool {
 	return &TxPool{
-		txs:       make(map[string]*types.Transaction),
-		queueChan: make(chan *types.Transaction, txPoolQueueSize),
-		quit:      make(chan bool),
-		eventMux:  eventMux,
+		all:             make(map[string]*types.Transaction),
+		pending:         make(map[string]*txList),
+		queue:           make(map[string]*txList),
+		locals:          make(map[string]bool),
+		mined:           make(map[string]uint64),
+		queueChan:       make(chan *types.Transaction, txPoolQueueSize),
+		quit:            make(chan bool),
+		chain:           chain,
+		maxTxs:          maxPoolTxs,
+		maxAccountQueue: maxAccountQueue,
+		eventMux:        eventMux,
 	}
 }
 
+// ValidateTransaction checks whether tx can be executed on top of the current
+// head. It returns a NonceErr, InsufficientFundsErr, IntrinsicGasErr or
+// GasLimitErr if the sender's account or the gas limit doesn't allow it.
 func (pool *TxPool) ValidateTransaction(tx *types.Transaction) error {
+	return pool.validateTx(pool.chain.State(), pool.chain.CurrentBlock(), tx)
+}
+
+func (pool *TxPool) validateTx(query StateQuery, head *types.Block, tx *types.Transaction) error {
 	if len(tx.To()) != 0 && len(tx.To()) != 20 {
 		return fmt.Errorf("Invalid recipient. len = %d", len(tx.To()))
 	}
@@ -65,43 +118,269 @@ func (pool *TxPool) ValidateTransaction(tx *types.Transaction) error {
 		return fmt.Errorf("tx.v != (28 || 27) => %v", v)
 	}
 
-	/* XXX this kind of validation needs to happen elsewhere in the gui when sending txs.
-	   Other clients should do their own validation. Value transfer could throw error
-	   but doesn't necessarily invalidate the tx. Gas can still be payed for and miner
-	   can still be rewarded for their inclusion and processing.
-	// Get the sender
 	senderAddr := tx.From()
 	if senderAddr == nil {
-		return fmt.Errorf("invalid sender")
+		return fmt.Errorf("Invalid sender")
+	}
+	sender := query.GetAccount(senderAddr)
+
+	if sender.Nonce > tx.Nonce() {
+		return NonceError(tx.Nonce(), sender.Nonce)
+	}
+
+	// The transaction has to fit into a block
+	if tx.Gas().Cmp(head.GasLimit()) > 0 {
+		return GasLimitError(tx.Gas(), head.GasLimit())
+	}
+
+	gasTable := pool.chain.Config().RulesAt(new(big.Int).Add(head.Number(), ethutil.Big1)).GasTable
+	if intrinsic := IntrinsicGas(tx.Data(), gasTable); tx.Gas().Cmp(intrinsic) < 0 {
+		return IntrinsicGasError(tx.Gas(), intrinsic)
 	}
-	sender := pool.stateQuery.GetAccount(senderAddr)
 
-	totAmount := new(big.Int).Set(tx.Value())
-	// Make sure there's enough in the sender's account. Having insufficient
-	// funds won't invalidate this transaction but simple ignores it.
+	// Make sure there's enough in the sender's account to pay for the gas
+	// and the value
+	totAmount := new(big.Int).Add(tx.Value(), MessageGasValue(tx))
 	if sender.Balance().Cmp(totAmount) < 0 {
-		return fmt.Errorf("Insufficient amount in sender's (%x) account", tx.From())
+		return InsufficientFundsError(sender.Balance(), totAmount)
 	}
-	*/
 
 	return nil
 }
 
-func (self *TxPool) addTx(tx *types.Transaction) {
-	self.txs[string(tx.Hash())] = tx
+// addTx inserts tx without validating it
+func (self *TxPool) addTx(tx *types.Transaction) error {
+	return self.add(self.chain.State(), tx)
+}
+
+// add inserts tx into the queue of its sender and promotes it if it's
+// executable. A pooled transaction with the same nonce is replaced if tx pays
+// a high enough gas price. The caller must hold the lock.
+func (self *TxPool) add(statedb *state.StateDB, tx *types.Transaction) error {
+	var (
+		from = string(tx.From())
+		hash = string(tx.Hash())
+	)
+
+	for _, lists := range []map[string]*txList{self.pending, self.queue} {
+		list := lists[from]
+		if list == nil {
+			continue
+		}
+		if old := list.Get(tx.Nonce()); old != nil {
+			threshold := new(big.Int).Mul(old.GasPrice(), big.NewInt(100+priceBump))
+			threshold.Div(threshold, big.NewInt(100))
+			if tx.GasPrice().Cmp(threshold) < 0 {
+				return fmt.Errorf("Replacement transaction (%x) underpriced. Gas price %v, need at least %v", tx.Hash()[:4], tx.GasPrice(), threshold)
+			}
+
+			self.forget(string(old.Hash()))
+			list.Put(tx)
+			self.all[hash] = tx
+
+			return nil
+		}
+	}
+
+	if nonce := statedb.GetNonce(tx.From()); tx.Nonce() < nonce {
+		return NonceError(tx.Nonce(), nonce)
+	}
+
+	if self.queue[from] == nil {
+		self.queue[from] = newTxList()
+	}
+	self.queue[from].Put(tx)
+	self.all[hash] = tx
+
+	self.promote(statedb, from)
+
+	// Enforce the limits of the pool
+	if queue := self.queue[from]; queue != nil {
+		for _, drop := range queue.Cap(self.maxAccountQueue) {
+			self.forget(string(drop.Hash()))
+		}
+	}
+	self.evict()
+
+	if self.all[hash] == nil {
+		return fmt.Errorf("Transaction (%x) dropped, pool limits reached", tx.Hash()[:4])
+	}
+
+	return nil
+}
+
+// promote moves the queued transactions of addr which became executable to
+// its pending list
+func (self *TxPool) promote(statedb *state.StateDB, addr string) {
+	queue := self.queue[addr]
+	if queue == nil {
+		return
+	}
+
+	pending := self.pending[addr]
+	next, ok := uint64(0), false
+	if pending != nil {
+		next, ok = pending.Next()
+	}
+	if !ok {
+		next = statedb.GetNonce([]byte(addr))
+	}
+
+	if ready := queue.Ready(next); len(ready) > 0 {
+		if pending == nil {
+			pending = newTxList()
+			self.pending[addr] = pending
+		}
+		for _, tx := range ready {
+			pending.Put(tx)
+		}
+	}
+
+	if queue.Len() == 0 {
+		delete(self.queue, addr)
+	}
+}
+
+// evict drops the cheapest remote transactions until the pool is within its
+// limit
+func (self *TxPool) evict() {
+	for len(self.all) > self.maxTxs {
+		var cheapest *types.Transaction
+		for hash, tx := range self.all {
+			if self.locals[hash] {
+				continue
+			}
+			if cheapest == nil {
+				cheapest = tx
+				continue
+			}
+			// Prefer dropping later nonces of equally priced transactions
+			if c := tx.GasPrice().Cmp(cheapest.GasPrice()); c < 0 || (c == 0 && tx.Nonce() > cheapest.Nonce()) {
+				cheapest = tx
+			}
+		}
+		if cheapest == nil {
+			break
+		}
+
+		self.removeTx(cheapest, true)
+	}
+}
+
+// removeTx drops tx from the pool. If demote is set the pending transactions
+// of the sender which followed tx are moved back to the queue as they can't
+// be executed anymore.
+func (self *TxPool) removeTx(tx *types.Transaction, demote bool) {
+	hash := string(tx.Hash())
+	pooled := self.all[hash]
+	if pooled == nil {
+		return
+	}
+	self.forget(hash)
+
+	addr := string(pooled.From())
+	if pending := self.pending[addr]; pending != nil && pending.Get(pooled.Nonce()) == pooled {
+		pending.Remove(pooled.Nonce())
+		if demote {
+			for _, tx := range pending.Above(pooled.Nonce()) {
+				if self.queue[addr] == nil {
+					self.queue[addr] = newTxList()
+				}
+				self.queue[addr].Put(tx)
+			}
+		}
+		if pending.Len() == 0 {
+			delete(self.pending, addr)
+		}
+	}
+	if queue := self.queue[addr]; queue != nil && queue.Get(pooled.Nonce()) == pooled {
+		queue.Remove(pooled.Nonce())
+		if queue.Len() == 0 {
+			delete(self.queue, addr)
+		}
+	}
 }
 
+// forget removes the bookkeeping of the transaction with the given hash
+func (self *TxPool) forget(hash string) {
+	delete(self.all, hash)
+	delete(self.locals, hash)
+}
+
+// forgetMined removes the bookkeeping of the transaction with the given hash
+// whose nonce was used by the head with the given number. A local
+// transaction is remembered as mined.
+func (self *TxPool) forgetMined(hash string, number uint64) {
+	if self.locals[hash] {
+		self.mined[hash] = number
+	}
+	self.forget(hash)
+}
+
+// requeue adds the transactions dropped from the chain by a reorganisation
+// again. The local ones which were mined are added as local.
+func (self *TxPool) requeue(txs types.Transactions) {
+	var local, remote types.Transactions
+
+	self.mu.Lock()
+	for _, tx := range txs {
+		hash := string(tx.Hash())
+		if _, ok := self.mined[hash]; ok {
+			delete(self.mined, hash)
+			local = append(local, tx)
+		} else {
+			remote = append(remote, tx)
+		}
+	}
+	self.mu.Unlock()
+
+	self.AddTransactions(remote)
+	for _, tx := range local {
+		if err := self.AddLocal(tx); err != nil {
+			txplogger.Infoln(err)
+		}
+	}
+}
+
+// Add validates and inserts a transaction received from the network
 func (self *TxPool) Add(tx *types.Transaction) error {
-	if self.txs[string(tx.Hash())] != nil {
+	return self.submit(tx, false)
+}
+
+// AddLocal validates and inserts a transaction submitted by the local node.
+// Local transactions are journaled and never evicted for cheaper ones.
+func (self *TxPool) AddLocal(tx *types.Transaction) error {
+	return self.submit(tx, true)
+}
+
+func (self *TxPool) submit(tx *types.Transaction, local bool) error {
+	// Fetch the head before locking, the chain may be waiting for the pool
+	statedb, head := self.chain.State(), self.chain.CurrentBlock()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	hash := string(tx.Hash())
+	if self.all[hash] != nil {
+		// A known remote transaction resubmitted locally becomes local
+		if local && !self.locals[hash] {
+			self.markLocal(tx)
+			return nil
+		}
 		return fmt.Errorf("Known transaction (%x)", tx.Hash()[0:4])
 	}
 
-	err := self.ValidateTransaction(tx)
+	err := self.validateTx(statedb, head, tx)
 	if err != nil {
 		return err
 	}
 
-	self.addTx(tx)
+	if err := self.add(statedb, tx); err != nil {
+		return err
+	}
+	if local {
+		self.markLocal(tx)
+	}
 
 	var to string
 	if len(tx.To()) > 0 {
@@ -118,11 +397,72 @@ func (self *TxPool) Add(tx *types.Transaction) error {
 	return nil
 }
 
+// markLocal flags the pooled tx as local and journals it. The caller must
+// hold the lock.
+func (self *TxPool) markLocal(tx *types.Transaction) {
+	self.locals[string(tx.Hash())] = true
+
+	if self.journal != nil {
+		if err := self.journal.insert(tx); err != nil {
+			txplogger.Infof("failed to journal local transaction (%x): %v\n", tx.Hash()[:4], err)
+		}
+	}
+}
+
+// IsLocal reports whether tx was submitted by the local node
+func (self *TxPool) IsLocal(tx *types.Transaction) bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.locals[string(tx.Hash())]
+}
+
+// local returns the pooled local transactions, the pending ones first. The
+// caller must hold the lock.
+func (self *TxPool) local() types.Transactions {
+	var txs types.Transactions
+	for _, tx := range append(flatten(self.pending), flatten(self.queue)...) {
+		if self.locals[string(tx.Hash())] {
+			txs = append(txs, tx)
+		}
+	}
+
+	return txs
+}
+
+// LoadJournal replays the local transactions journaled at path into the pool
+// and rewrites the journal with the ones still pooled, dropping those which
+// were mined in the meantime. Local transactions added afterwards are
+// appended to the journal.
+func (self *TxPool) LoadJournal(path string) error {
+	journal := newTxJournal(path)
+	// A corrupt journal is rewritten with the transactions read up to the
+	// damaged entry
+	if err := journal.load(self.AddLocal); err != nil {
+		txplogger.Infoln(err)
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if err := journal.rotate(self.local()); err != nil {
+		return err
+	}
+	self.journal = journal
+
+	return nil
+}
+
 func (self *TxPool) Size() int {
-	return len(self.txs)
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return len(self.all)
 }
 
 func (self *TxPool) AddTransactions(txs []*types.Transaction) {
+	recoverSenders(txs)
+
 	for _, tx := range txs {
 		if err := self.Add(tx); err != nil {
 			txplogger.Infoln(err)
@@ -132,48 +472,181 @@ func (self *TxPool) AddTransactions(txs []*types.Transaction) {
 	}
 }
 
+// GetTransactions returns all pooled transactions, the pending ones first
 func (self *TxPool) GetTransactions() (txs types.Transactions) {
-	txs = make(types.Transactions, self.Size())
-	i := 0
-	for _, tx := range self.txs {
-		txs[i] = tx
-		i++
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return append(flatten(self.pending), flatten(self.queue)...)
+}
+
+// Pending returns the executable transactions. The transactions of each
+// account are ordered by nonce.
+func (self *TxPool) Pending() types.Transactions {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return flatten(self.pending)
+}
+
+// PendingNonce returns the nonce following the pending transactions of addr,
+// or the nonce of its account in the head state if it has none
+func (self *TxPool) PendingNonce(addr []byte) uint64 {
+	statedb := self.chain.State()
+
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	if pending := self.pending[string(addr)]; pending != nil {
+		if next, ok := pending.Next(); ok {
+			return next
+		}
 	}
 
-	return
+	return statedb.GetNonce(addr)
 }
 
+// Queued returns the transactions waiting for a nonce gap to be filled
+func (self *TxPool) Queued() types.Transactions {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return flatten(self.queue)
+}
+
+func flatten(lists map[string]*txList) types.Transactions {
+	var txs types.Transactions
+	for _, list := range lists {
+		txs = append(txs, list.Flatten()...)
+	}
+
+	return txs
+}
+
+// RemoveInvalid drops the transactions which are no longer valid given the
+// accounts in query
 func (pool *TxPool) RemoveInvalid(query StateQuery) {
-	var removedTxs types.Transactions
-	for _, tx := range pool.txs {
-		sender := query.GetAccount(tx.From())
-		err := pool.ValidateTransaction(tx)
-		fmt.Println(err, sender.Nonce, tx.Nonce())
-		if err != nil || sender.Nonce >= tx.Nonce() {
-			removedTxs = append(removedTxs, tx)
+	head := pool.chain.CurrentBlock()
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for _, tx := range pool.all {
+		if err := pool.validateTx(query, head, tx); err != nil {
+			pool.removeTx(tx, true)
 		}
 	}
-
-	pool.RemoveSet(removedTxs)
 }
 
 func (self *TxPool) RemoveSet(txs types.Transactions) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
 	for _, tx := range txs {
-		delete(self.txs, string(tx.Hash()))
+		self.removeTx(tx, false)
+	}
+}
+
+// resetState drops the transactions made stale by a new head. Pending
+// transactions following a nonce gap are moved back to the queue and queued
+// transactions which became executable are promoted.
+func (pool *TxPool) resetState() {
+	statedb, number := pool.chain.State(), pool.chain.CurrentBlock().NumberU64()
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for hash, minedAt := range pool.mined {
+		if minedAt+minedLocalsDepth < number {
+			delete(pool.mined, hash)
+		}
+	}
+
+	for addr, list := range pool.pending {
+		nonce := statedb.GetNonce([]byte(addr))
+		for _, tx := range list.Forward(nonce) {
+			pool.forgetMined(string(tx.Hash()), number)
+		}
+
+		ready := list.Ready(nonce)
+		if list.Len() > 0 {
+			if pool.queue[addr] == nil {
+				pool.queue[addr] = newTxList()
+			}
+			for _, tx := range list.Flatten() {
+				pool.queue[addr].Put(tx)
+			}
+		}
+
+		if len(ready) == 0 {
+			delete(pool.pending, addr)
+			continue
+		}
+		pending := newTxList()
+		for _, tx := range ready {
+			pending.Put(tx)
+		}
+		pool.pending[addr] = pending
+	}
+
+	for addr, list := range pool.queue {
+		for _, tx := range list.Forward(statedb.GetNonce([]byte(addr))) {
+			pool.forgetMined(string(tx.Hash()), number)
+		}
+		pool.promote(statedb, addr)
 	}
 }
 
 func (pool *TxPool) Flush() []*types.Transaction {
-	txList := pool.GetTransactions()
-	pool.txs = make(map[string]*types.Transaction)
+	txs := pool.GetTransactions()
+
+	pool.mu.Lock()
+	pool.all = make(map[string]*types.Transaction)
+	pool.pending = make(map[string]*txList)
+	pool.queue = make(map[string]*txList)
+	pool.locals = make(map[string]bool)
+	pool.mined = make(map[string]uint64)
+	pool.mu.Unlock()
 
-	return txList
+	return txs
 }
 
 func (pool *TxPool) Start() {
+	// Transactions dropped by a chain reorganisation are queued again and
+	// every new head updates the pending transactions
+	pool.events = pool.eventMux.Subscribe(RemovedTransactionsEvent{}, ChainHeadEvent{})
+	go pool.eventLoop()
+}
+
+func (pool *TxPool) eventLoop() {
+	// automatically stops if unsubscribe
+	for obj := range pool.events.Chan() {
+		switch ev := obj.(type) {
+		case RemovedTransactionsEvent:
+			txplogger.Infof("re-queueing %d transaction(s) dropped from the chain\n", len(ev.Txs))
+			pool.requeue(ev.Txs)
+		case ChainHeadEvent:
+			pool.resetState()
+		}
+	}
 }
 
 func (pool *TxPool) Stop() {
+	if pool.events != nil {
+		pool.events.Unsubscribe()
+	}
+
+	// Leave only the unmined local transactions in the journal
+	pool.mu.Lock()
+	if pool.journal != nil {
+		if err := pool.journal.rotate(pool.local()); err != nil {
+			txplogger.Infoln("failed to rotate transaction journal:", err)
+		}
+		pool.journal.close()
+		pool.journal = nil
+	}
+	pool.mu.Unlock()
+
 	pool.Flush()
 
 	txplogger.Infoln("Stopped")
@@ -1,7 +1,12 @@
 package core
 
 import (
+	"bytes"
 	"crypto/ecdsa"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/core/types"
@@ -9,6 +14,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethutil"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/state"
 )
 
@@ -24,14 +30,35 @@ func (self stateQuery) GetAccount(addr []byte) *state.StateObject {
 	return state.NewStateObject(addr, self.db)
 }
 
+// testChain hands the pool a fixed head and state
+type testChain struct {
+	statedb *state.StateDB
+	head    *types.Block
+	config  *ChainConfig
+}
+
+func (self *testChain) State() *state.StateDB      { return self.statedb }
+func (self *testChain) CurrentBlock() *types.Block { return self.head }
+func (self *testChain) Config() *ChainConfig       { return self.config }
+
 func transaction() *types.Transaction {
-	return types.NewTransactionMessage(make([]byte, 20), ethutil.Big0, ethutil.Big0, ethutil.Big0, nil)
+	return types.NewTransactionMessage(make([]byte, 20), ethutil.Big0, big.NewInt(100000), ethutil.Big0, nil)
 }
 
 func setup() (*TxPool, *ecdsa.PrivateKey) {
-	var m event.TypeMux
+	db, _ := ethdb.NewMemDatabase()
+	head := types.NewBlock(ZeroHash256, ZeroHash160, nil, ethutil.Big1, nil, "")
+	head.Header().Number = ethutil.Big0
+	head.Header().GasLimit = big.NewInt(1000000)
+	chain := &testChain{statedb: state.New(nil, db), head: head, config: DefaultChainConfig()}
+
+	// Fund the sender
 	key, _ := crypto.GenerateKey()
-	return NewTxPool(&m), key
+	addr := crypto.Sha3(crypto.FromECDSAPub(&key.PublicKey)[1:])[12:]
+	chain.statedb.GetOrNewStateObject(addr).SetBalance(ethutil.BigPow(10, 18))
+
+	var m event.TypeMux
+	return NewTxPool(&m, chain), key
 }
 
 func TestTxAdding(t *testing.T) {
@@ -85,3 +112,306 @@ func TestRemoveInvalid(t *testing.T) {
 		t.Error("expected pool size to be 1, is", pool.Size())
 	}
 }
+
+func pricedTransaction(nonce uint64, price int64, key *ecdsa.PrivateKey) *types.Transaction {
+	tx := types.NewTransactionMessage(make([]byte, 20), ethutil.Big0, big.NewInt(100000), big.NewInt(price), nil)
+	tx.SetNonce(nonce)
+	tx.SignECDSA(key)
+
+	return tx
+}
+
+func TestPendingQueued(t *testing.T) {
+	pool, key := setup()
+
+	// A nonce gap keeps transactions queued until it's filled
+	for _, nonce := range []uint64{1, 2, 4} {
+		if err := pool.Add(pricedTransaction(nonce, 1, key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p, q := len(pool.Pending()), len(pool.Queued()); p != 0 || q != 3 {
+		t.Fatalf("pending/queued mismatch: have %d/%d, want 0/3", p, q)
+	}
+
+	if err := pool.Add(pricedTransaction(0, 1, key)); err != nil {
+		t.Fatal(err)
+	}
+	pending := pool.Pending()
+	if p, q := len(pending), len(pool.Queued()); p != 3 || q != 1 {
+		t.Fatalf("pending/queued mismatch: have %d/%d, want 3/1", p, q)
+	}
+	for i, tx := range pending {
+		if tx.Nonce() != uint64(i) {
+			t.Errorf("pending tx %d: nonce %d", i, tx.Nonce())
+		}
+	}
+
+	// A new head drops the stale nonces and promotes the queue
+	statedb := pool.chain.State()
+	statedb.GetOrNewStateObject(pending[0].From()).Nonce = 3
+	pool.resetState()
+	if p, q := len(pool.Pending()), len(pool.Queued()); p != 0 || q != 1 {
+		t.Fatalf("pending/queued mismatch: have %d/%d, want 0/1", p, q)
+	}
+	if err := pool.Add(pricedTransaction(3, 1, key)); err != nil {
+		t.Fatal(err)
+	}
+	if p, q := len(pool.Pending()), len(pool.Queued()); p != 2 || q != 0 {
+		t.Fatalf("pending/queued mismatch: have %d/%d, want 2/0", p, q)
+	}
+
+	if err := pool.Add(pricedTransaction(2, 1, key)); !IsNonceErr(err) {
+		t.Error("expected nonce error for a stale nonce, got", err)
+	}
+	if pool.Size() != 2 {
+		t.Error("expected pool size to be 2, is", pool.Size())
+	}
+}
+
+func TestPendingNonce(t *testing.T) {
+	pool, key := setup()
+	addr := pricedTransaction(0, 1, key).From()
+
+	if nonce := pool.PendingNonce(addr); nonce != 0 {
+		t.Errorf("nonce mismatch for an empty pool: got %d, want 0", nonce)
+	}
+	// Queued transactions behind a gap don't count
+	for _, nonce := range []uint64{0, 1, 3} {
+		if err := pool.Add(pricedTransaction(nonce, 1, key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if nonce := pool.PendingNonce(addr); nonce != 2 {
+		t.Errorf("nonce mismatch: got %d, want 2", nonce)
+	}
+
+	// Once mined the head state has the nonce
+	pool.chain.State().GetOrNewStateObject(addr).Nonce = 2
+	pool.resetState()
+	if nonce := pool.PendingNonce(addr); nonce != 2 {
+		t.Errorf("nonce mismatch after the transactions were mined: got %d, want 2", nonce)
+	}
+}
+
+func TestReplaceTransaction(t *testing.T) {
+	pool, key := setup()
+
+	if err := pool.Add(pricedTransaction(0, 100, key)); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(pricedTransaction(0, 105, key)); err == nil {
+		t.Error("expected an underpriced replacement to be rejected")
+	}
+	if err := pool.Add(pricedTransaction(0, 110, key)); err != nil {
+		t.Fatal(err)
+	}
+
+	pending := pool.Pending()
+	if len(pending) != 1 || pending[0].GasPrice().Cmp(big.NewInt(110)) != 0 || pool.Size() != 1 {
+		t.Errorf("replacement failed: pending %v, size %d", pending, pool.Size())
+	}
+}
+
+func TestPoolLimits(t *testing.T) {
+	pool, key := setup()
+	pool.maxAccountQueue = 2
+	pool.maxTxs = 3
+
+	// Only the lowest nonces of the queue are kept
+	for _, nonce := range []uint64{3, 1, 2} {
+		pool.Add(pricedTransaction(nonce, 1, key))
+	}
+	queued := pool.Queued()
+	if len(queued) != 2 || queued[0].Nonce() != 1 || queued[1].Nonce() != 2 {
+		t.Fatalf("queue cap failed: %v", queued)
+	}
+
+	// The cheapest transactions are evicted when the pool is full
+	if err := pool.Add(pricedTransaction(0, 5, key)); err != nil {
+		t.Fatal(err)
+	}
+	key2, _ := crypto.GenerateKey()
+	pool.chain.State().GetOrNewStateObject(pricedTransaction(0, 0, key2).From()).SetBalance(ethutil.BigPow(10, 18))
+	if err := pool.Add(pricedTransaction(0, 10, key2)); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Size() != 3 {
+		t.Fatal("expected pool size to be 3, is", pool.Size())
+	}
+	if err := pool.Add(pricedTransaction(1, 0, key2)); err == nil {
+		t.Error("expected the cheapest transaction to be rejected by a full pool")
+	}
+
+	// Evicting a pending transaction moves its successors to the queue
+	pool.maxTxs = 10
+	if err := pool.Add(pricedTransaction(2, 20, key)); err != nil {
+		t.Fatal(err)
+	}
+	pool.maxTxs = 3
+	pool.mu.Lock()
+	pool.evict()
+	pool.mu.Unlock()
+	if p, q := len(pool.Pending()), len(pool.Queued()); p != 2 || q != 1 {
+		t.Errorf("pending/queued mismatch: have %d/%d, want 2/1", p, q)
+	}
+}
+
+func TestValidateTransaction(t *testing.T) {
+	pool, key := setup()
+	statedb := pool.chain.State()
+
+	tx := transaction()
+	tx.SetNonce(1)
+	tx.SignECDSA(key)
+	statedb.GetOrNewStateObject(tx.From()).Nonce = 2
+	if err := pool.ValidateTransaction(tx); !IsNonceErr(err) {
+		t.Error("expected nonce error, got", err)
+	}
+	statedb.GetOrNewStateObject(tx.From()).Nonce = 0
+
+	tx = transaction()
+	tx.Price = ethutil.BigPow(10, 12)
+	tx.SignECDSA(key)
+	if err := pool.ValidateTransaction(tx); err != nil {
+		t.Error(err)
+	}
+	// gas * price exceeds the balance
+	tx.Price = ethutil.BigPow(10, 14)
+	tx.SignECDSA(key)
+	if err := pool.ValidateTransaction(tx); !IsInsufficientFundsErr(err) {
+		t.Error("expected insufficient funds error, got", err)
+	}
+
+	tx = transaction()
+	tx.GasLimit = big.NewInt(499)
+	tx.SignECDSA(key)
+	if err := pool.ValidateTransaction(tx); !IsIntrinsicGasErr(err) {
+		t.Error("expected intrinsic gas error, got", err)
+	}
+	tx.GasLimit = big.NewInt(500)
+	tx.Payload = []byte{1}
+	tx.SignECDSA(key)
+	if err := pool.ValidateTransaction(tx); !IsIntrinsicGasErr(err) {
+		t.Error("expected intrinsic gas error for the payload, got", err)
+	}
+
+	tx = transaction()
+	tx.GasLimit = big.NewInt(1000001)
+	tx.SignECDSA(key)
+	if err := pool.ValidateTransaction(tx); !IsGasLimitErr(err) {
+		t.Error("expected gas limit error, got", err)
+	}
+}
+
+func TestLocalJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txjournal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	journal := path.Join(dir, "transactions.rlp")
+
+	pool, key := setup()
+	if err := pool.LoadJournal(journal); err != nil {
+		t.Fatal(err)
+	}
+	statedb := pool.chain.State()
+
+	// Local transactions are journaled, remote ones aren't
+	key2, _ := crypto.GenerateKey()
+	statedb.GetOrNewStateObject(pricedTransaction(0, 0, key2).From()).SetBalance(ethutil.BigPow(10, 18))
+	for _, tx := range []*types.Transaction{pricedTransaction(0, 1, key), pricedTransaction(1, 1, key)} {
+		if err := pool.AddLocal(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remote := pricedTransaction(0, 2, key2)
+	if err := pool.Add(remote); err != nil {
+		t.Fatal(err)
+	}
+	if pool.IsLocal(remote) {
+		t.Error("remote transaction marked local")
+	}
+
+	// Local transactions survive a full pool
+	pool.maxTxs = 2
+	if err := pool.Add(pricedTransaction(1, 10, key2)); err == nil {
+		t.Error("expected remote transaction to be rejected by a pool full of local ones")
+	}
+	pool.Stop()
+
+	// The mined transaction isn't replayed and gets rotated out
+	statedb.GetOrNewStateObject(pricedTransaction(0, 0, key).From()).Nonce = 1
+	pool = NewTxPool(pool.eventMux, pool.chain)
+	if err := pool.LoadJournal(journal); err != nil {
+		t.Fatal(err)
+	}
+	pending := pool.Pending()
+	if len(pending) != 1 || pending[0].Nonce() != 1 || !pool.IsLocal(pending[0]) {
+		t.Fatalf("expected the unmined local transaction to be replayed, got %v", pending)
+	}
+	pool.Stop()
+
+	var count int
+	stream := rlp.NewStream(bytes.NewReader(mustReadFile(t, journal)))
+	for stream.Decode(new(types.Transaction)) == nil {
+		count++
+	}
+	if count != 1 {
+		t.Errorf("journal holds %d transactions, want 1", count)
+	}
+}
+
+func mustReadFile(t *testing.T, fn string) []byte {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRequeueMinedLocal(t *testing.T) {
+	pool, key := setup()
+	chain := pool.chain.(*testChain)
+
+	key2, _ := crypto.GenerateKey()
+	local, remote := pricedTransaction(0, 1, key), pricedTransaction(0, 2, key2)
+	chain.statedb.GetOrNewStateObject(remote.From()).SetBalance(ethutil.BigPow(10, 18))
+	if err := pool.AddLocal(local); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(remote); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both are mined and then dropped by a reorganisation
+	mine := func(nonce uint64) {
+		for _, tx := range []*types.Transaction{local, remote} {
+			chain.statedb.GetOrNewStateObject(tx.From()).Nonce = nonce
+		}
+		chain.head.Header().Number = new(big.Int).Add(chain.head.Number(), ethutil.Big1)
+		pool.resetState()
+	}
+	mine(1)
+	if pool.Size() != 0 {
+		t.Fatalf("expected the mined transactions to be dropped, %d pooled", pool.Size())
+	}
+	mine(0)
+	pool.requeue(types.Transactions{local, remote})
+	if pool.Size() != 2 {
+		t.Fatalf("expected the transactions to be pooled again, %d pooled", pool.Size())
+	}
+	if !pool.IsLocal(local) || pool.IsLocal(remote) {
+		t.Errorf("local flags mismatch: got %v/%v, want true/false", pool.IsLocal(local), pool.IsLocal(remote))
+	}
+
+	// Transactions mined long ago aren't remembered
+	mine(1)
+	chain.head.Header().Number = big.NewInt(minedLocalsDepth + 10)
+	mine(0)
+	pool.requeue(types.Transactions{local})
+	if pool.IsLocal(local) {
+		t.Error("expected a local transaction mined too long ago to be added as remote")
+	}
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// txJournal is an append only file of RLP encoded transactions, used to keep
+// the transactions submitted by the local node across restarts
+type txJournal struct {
+	path   string
+	writer io.WriteCloser
+}
+
+func newTxJournal(path string) *txJournal {
+	return &txJournal{path: path}
+}
+
+// load reads the journal and passes every transaction in it to add. A missing
+// journal isn't an error.
+func (self *txJournal) load(add func(*types.Transaction) error) error {
+	file, err := os.Open(self.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var (
+		stream = rlp.NewStream(file)
+		total  int
+		failed int
+	)
+	for {
+		tx := new(types.Transaction)
+		if err = stream.Decode(tx); err != nil {
+			break
+		}
+		total++
+		if err := add(tx); err != nil {
+			txplogger.Debugf("journaled transaction (%x) dropped: %v\n", tx.Hash()[:4], err)
+			failed++
+		}
+	}
+	txplogger.Infof("Loaded %d local transaction(s) from journal, %d dropped\n", total, failed)
+
+	if err != io.EOF {
+		return fmt.Errorf("journal %s corrupt after %d transaction(s): %v", self.path, total, err)
+	}
+
+	return nil
+}
+
+// insert appends tx to the journal
+func (self *txJournal) insert(tx *types.Transaction) error {
+	if self.writer == nil {
+		return fmt.Errorf("journal %s not open for writing", self.path)
+	}
+	_, err := self.writer.Write(ethutil.Encode(tx))
+
+	return err
+}
+
+// rotate replaces the journal with one holding just txs and keeps it open for
+// further inserts
+func (self *txJournal) rotate(txs types.Transactions) error {
+	if self.writer != nil {
+		if err := self.writer.Close(); err != nil {
+			return err
+		}
+		self.writer = nil
+	}
+
+	replacement, err := os.OpenFile(self.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		if _, err := replacement.Write(ethutil.Encode(tx)); err != nil {
+			replacement.Close()
+			return err
+		}
+	}
+	replacement.Close()
+
+	if err := os.Rename(self.path+".new", self.path); err != nil {
+		return err
+	}
+	sink, err := os.OpenFile(self.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	self.writer = sink
+
+	return nil
+}
+
+func (self *txJournal) close() error {
+	var err error
+	if self.writer != nil {
+		err = self.writer.Close()
+		self.writer = nil
+	}
+
+	return err
+}
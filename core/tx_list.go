@@ -0,0 +1,121 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// txList holds the pooled transactions of a single account keyed by nonce
+type txList struct {
+	items map[uint64]*types.Transaction
+}
+
+func newTxList() *txList {
+	return &txList{items: make(map[uint64]*types.Transaction)}
+}
+
+func (self *txList) Len() int {
+	return len(self.items)
+}
+
+func (self *txList) Get(nonce uint64) *types.Transaction {
+	return self.items[nonce]
+}
+
+// Put inserts tx, replacing any transaction with the same nonce
+func (self *txList) Put(tx *types.Transaction) {
+	self.items[tx.Nonce()] = tx
+}
+
+func (self *txList) Remove(nonce uint64) bool {
+	if _, ok := self.items[nonce]; !ok {
+		return false
+	}
+	delete(self.items, nonce)
+
+	return true
+}
+
+// Forward removes and returns the transactions with a nonce lower than threshold
+func (self *txList) Forward(threshold uint64) types.Transactions {
+	var removed types.Transactions
+	for nonce, tx := range self.items {
+		if nonce < threshold {
+			removed = append(removed, tx)
+			delete(self.items, nonce)
+		}
+	}
+
+	return removed
+}
+
+// Ready removes and returns the sequence of transactions with consecutive
+// nonces starting at start
+func (self *txList) Ready(start uint64) types.Transactions {
+	var ready types.Transactions
+	for nonce := start; ; nonce++ {
+		tx, ok := self.items[nonce]
+		if !ok {
+			break
+		}
+		ready = append(ready, tx)
+		delete(self.items, nonce)
+	}
+
+	return ready
+}
+
+// Above removes and returns the transactions with a nonce higher than threshold
+func (self *txList) Above(threshold uint64) types.Transactions {
+	var removed types.Transactions
+	for nonce, tx := range self.items {
+		if nonce > threshold {
+			removed = append(removed, tx)
+			delete(self.items, nonce)
+		}
+	}
+
+	return removed
+}
+
+// Cap removes and returns the transactions with the highest nonces until at
+// most max are left
+func (self *txList) Cap(max int) types.Transactions {
+	if len(self.items) <= max {
+		return nil
+	}
+	txs := self.Flatten()
+	for _, tx := range txs[max:] {
+		delete(self.items, tx.Nonce())
+	}
+
+	return txs[max:]
+}
+
+// Flatten returns the transactions ordered by nonce
+func (self *txList) Flatten() types.Transactions {
+	txs := make(types.Transactions, 0, len(self.items))
+	for _, tx := range self.items {
+		txs = append(txs, tx)
+	}
+	sort.Sort(types.TxByNonce{Transactions: txs})
+
+	return txs
+}
+
+// Next returns the nonce following the highest one in the list, or 0 and
+// false if it's empty
+func (self *txList) Next() (uint64, bool) {
+	if len(self.items) == 0 {
+		return 0, false
+	}
+	var max uint64
+	for nonce := range self.items {
+		if nonce > max {
+			max = nonce
+		}
+	}
+
+	return max + 1, true
+}
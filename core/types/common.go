@@ -3,9 +3,12 @@ package types
 import (
 	"math/big"
 
+	"github.com/ethereum/go-ethereum/ethutil"
 	"github.com/ethereum/go-ethereum/state"
 )
 
 type BlockProcessor interface {
-	Process(*Block) (*big.Int, state.Messages, error)
+	// Process validates the block and writes its state to the batch, which
+	// is written by the caller along with the block
+	Process(*Block, ethutil.Batch) (*big.Int, state.Messages, error)
 }
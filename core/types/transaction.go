@@ -5,6 +5,7 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"math/big"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethutil"
@@ -25,6 +26,22 @@ type Transaction struct {
 	Payload      []byte
 	V            uint64
 	R, S         []byte
+
+	// Sender recovered from the signature, see From
+	from atomic.Value
+}
+
+// senderCache remembers the sender recovered for a signing hash and signature
+// so it's only recomputed if the transaction was modified
+type senderCache struct {
+	hash []byte
+	v    uint64
+	r, s []byte
+	addr []byte
+}
+
+func (self *senderCache) matches(hash []byte, tx *Transaction) bool {
+	return self.v == tx.V && bytes.Equal(self.hash, hash) && bytes.Equal(self.r, tx.R) && bytes.Equal(self.s, tx.S)
 }
 
 func NewContractCreationTx(Amount, gasAmount, price *big.Int, data []byte) *Transaction {
@@ -79,8 +96,24 @@ func (self *Transaction) SetNonce(AccountNonce uint64) {
 	self.AccountNonce = AccountNonce
 }
 
+// From returns the address recovered from the signature, or nil if the
+// signature is invalid. The address is cached, From is safe for concurrent use.
 func (self *Transaction) From() []byte {
-	return self.sender()
+	hash := self.Hash()
+	if cache, ok := self.from.Load().(*senderCache); ok && cache.matches(hash, self) {
+		return cache.addr
+	}
+
+	addr := self.sender(hash)
+	self.from.Store(&senderCache{
+		hash: hash,
+		v:    self.V,
+		r:    ethutil.CopyBytes(self.R),
+		s:    ethutil.CopyBytes(self.S),
+		addr: addr,
+	})
+
+	return addr
 }
 
 func (self *Transaction) To() []byte {
@@ -104,8 +137,10 @@ func (tx *Transaction) Signature(key []byte) []byte {
 }
 
 func (tx *Transaction) PublicKey() []byte {
-	hash := tx.Hash()
+	return tx.publicKey(tx.Hash())
+}
 
+func (tx *Transaction) publicKey(hash []byte) []byte {
 	v, r, s := tx.Curve()
 
 	sig := append(r, s...)
@@ -117,8 +152,8 @@ func (tx *Transaction) PublicKey() []byte {
 	return pubkey
 }
 
-func (tx *Transaction) sender() []byte {
-	pubkey := tx.PublicKey()
+func (tx *Transaction) sender(hash []byte) []byte {
+	pubkey := tx.publicKey(hash)
 
 	// Validate the returned key.
 	// Return nil if public key isn't in full format
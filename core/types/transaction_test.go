@@ -1 +1,34 @@
 package types
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSenderCache(t *testing.T) {
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	addr1 := crypto.Sha3(crypto.FromECDSAPub(&key1.PublicKey)[1:])[12:]
+	addr2 := crypto.Sha3(crypto.FromECDSAPub(&key2.PublicKey)[1:])[12:]
+
+	tx := NewTransactionMessage(make([]byte, 20), big.NewInt(1), big.NewInt(1000), big.NewInt(1), nil)
+	tx.SignECDSA(key1)
+	if from := tx.From(); !bytes.Equal(from, addr1) {
+		t.Fatalf("sender mismatch: got %x, want %x", from, addr1)
+	}
+
+	// Signing again must not return the cached sender
+	tx.SignECDSA(key2)
+	if from := tx.From(); !bytes.Equal(from, addr2) {
+		t.Fatalf("sender mismatch after resigning: got %x, want %x", from, addr2)
+	}
+
+	// Neither may modifying the signed fields
+	tx.Price = big.NewInt(2)
+	if from := tx.From(); bytes.Equal(from, addr2) {
+		t.Error("cached sender returned for a modified transaction")
+	}
+}
@@ -9,11 +9,14 @@ import (
 )
 
 type VMEnv struct {
-	state *state.StateDB
-	block *types.Block
-	msg   Message
-	depth int
-	chain *ChainManager
+	state      *state.StateDB
+	block      *types.Block
+	msg        Message
+	depth      int
+	frameDepth int
+	chain      *ChainManager
+
+	tracer vm.Tracer
 }
 
 func NewEnv(state *state.StateDB, chain *ChainManager, msg Message, block *types.Block) *VMEnv {
@@ -35,6 +38,18 @@ func (self *VMEnv) Value() *big.Int       { return self.msg.Value() }
 func (self *VMEnv) State() *state.StateDB { return self.state }
 func (self *VMEnv) Depth() int            { return self.depth }
 func (self *VMEnv) SetDepth(i int)        { self.depth = i }
+func (self *VMEnv) FrameDepth() int       { return self.frameDepth }
+func (self *VMEnv) SetFrameDepth(i int)   { self.frameDepth = i }
+func (self *VMEnv) GasTable() *vm.GasTable {
+	return self.chain.Config().RulesAt(self.block.Number()).GasTable
+}
+func (self *VMEnv) JumpTable() *vm.JumpTable {
+	return self.chain.Config().RulesAt(self.block.Number()).JumpTable
+}
+func (self *VMEnv) Tracer() vm.Tracer { return self.tracer }
+
+// SetTracer makes the VM report every step of its execution to tracer
+func (self *VMEnv) SetTracer(tracer vm.Tracer) { self.tracer = tracer }
 func (self *VMEnv) GetHash(n uint64) []byte {
 	if block := self.chain.GetBlockByNumber(n); block != nil {
 		return block.Hash()
@@ -59,7 +74,7 @@ func (self *VMEnv) Call(me vm.ContextRef, addr, data []byte, gas, price, value *
 }
 func (self *VMEnv) CallCode(me vm.ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error) {
 	exe := self.vm(me.Address(), data, gas, price, value)
-	return exe.Call(addr, me)
+	return exe.CallCode(addr, me)
 }
 
 func (self *VMEnv) Create(me vm.ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error, vm.ContextRef) {
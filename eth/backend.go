@@ -3,6 +3,7 @@ package eth
 import (
 	"fmt"
 	"net"
+	"path"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/core"
@@ -14,11 +15,16 @@ import (
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/pow/ezp"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/state"
+	"github.com/ethereum/go-ethereum/trie"
 	"github.com/ethereum/go-ethereum/whisper"
 )
 
 const (
 	seedNodeAddress = "poc-8.ethdev.com:30303"
+
+	// File in the data directory journaling the local transactions
+	txJournalName = "transactions.rlp"
 )
 
 type Config struct {
@@ -40,6 +46,20 @@ type Config struct {
 	Dial bool
 
 	KeyManager *crypto.KeyManager
+
+	// Genesis is the specification of the genesis block. The default genesis
+	// is used when it's nil.
+	Genesis *core.Genesis
+	// ChainConfig holds the consensus parameters of the network. The default
+	// parameters are used when it's nil.
+	ChainConfig *core.ChainConfig
+
+	// PruneBlocks is the number of recent blocks whose state is kept, older
+	// state is deleted. Zero keeps the state of every block (archive mode).
+	PruneBlocks uint64
+	// TrieCacheSize is the number of bytes of trie nodes kept in memory and
+	// shared by the tries of the chain. Zero disables the cache.
+	TrieCacheSize int
 }
 
 var logger = ethlogger.NewLogger("SERV")
@@ -51,7 +71,10 @@ type Ethereum struct {
 
 	// DB interface
 	db        ethutil.Database
+	pruner    *state.Pruner
+	trieCache *trie.NodeCache
 	blacklist p2p.Blacklist
+	dataDir   string
 
 	//*** SERVICES ***
 	// State manager for processing new blocks and managing the over all states
@@ -86,11 +109,16 @@ func New(config *Config) (*Ethereum, error) {
 		return nil, err
 	}
 
+	chainConfig := config.ChainConfig
+	if chainConfig == nil {
+		chainConfig = core.DefaultChainConfig()
+	}
+
 	// Perform database sanity checks
 	d, _ := db.Get([]byte("ProtocolVersion"))
 	protov := ethutil.NewValue(d).Uint()
-	if protov != ProtocolVersion && protov != 0 {
-		return nil, fmt.Errorf("Database version mismatch. Protocol(%d / %d). `rm -rf %s`", protov, ProtocolVersion, ethutil.Config.ExecPath+"/database")
+	if protov != uint64(chainConfig.ProtocolVersion) && protov != 0 {
+		return nil, fmt.Errorf("Database version mismatch. Protocol(%d / %d). `rm -rf %s`", protov, chainConfig.ProtocolVersion, ethutil.Config.ExecPath+"/database")
 	}
 
 	// Create new keymanager
@@ -109,13 +137,14 @@ func New(config *Config) (*Ethereum, error) {
 	// Create a new client id for this instance. This will help identifying the node on the network
 	clientId := p2p.NewSimpleClientIdentity(config.Name, config.Version, config.Identifier, keyManager.PublicKey())
 
-	saveProtocolVersion(db)
+	saveProtocolVersion(db, chainConfig.ProtocolVersion)
 	//ethutil.Config.Db = db
 
 	eth := &Ethereum{
 		shutdownChan:   make(chan bool),
 		quit:           make(chan bool),
 		db:             db,
+		dataDir:        config.DataDir,
 		keyManager:     keyManager,
 		clientIdentity: clientId,
 		blacklist:      p2p.NewBlacklist(),
@@ -123,9 +152,36 @@ func New(config *Config) (*Ethereum, error) {
 		logger:         logger,
 	}
 
-	eth.chainManager = core.NewChainManager(db, eth.EventMux())
-	eth.txPool = core.NewTxPool(eth.EventMux())
-	eth.blockProcessor = core.NewBlockProcessor(db, eth.txPool, eth.chainManager, eth.EventMux())
+	// Trie nodes are cached across blocks, the tries of the chain share them
+	var chainDb ethutil.Database = db
+	if config.TrieCacheSize > 0 {
+		eth.trieCache = trie.NewNodeCache(config.TrieCacheSize)
+		chainDb = trie.NewCachedDatabase(db, eth.trieCache)
+		eth.db = chainDb
+	}
+
+	genesisSpec := config.Genesis
+	if genesisSpec == nil {
+		genesisSpec = core.DefaultGenesis()
+	}
+	genesis, err := genesisSpec.Block(chainDb, chainConfig)
+	if err != nil {
+		return nil, err
+	}
+	eth.chainManager, err = core.NewChainManagerWithGenesis(chainDb, genesis, chainConfig, eth.EventMux())
+	if err != nil {
+		return nil, err
+	}
+	eth.txPool = core.NewTxPool(eth.EventMux(), eth.chainManager)
+
+	// Block state is written through the pruner, if any, to be swept later
+	stateDb := chainDb
+	if config.PruneBlocks > 0 {
+		eth.pruner = state.NewPruner(db, config.PruneBlocks, eth.trieCache)
+		eth.chainManager.SetPruner(eth.pruner)
+		stateDb = eth.pruner
+	}
+	eth.blockProcessor = core.NewBlockProcessor(stateDb, eth.txPool, eth.chainManager, eth.EventMux())
 	eth.chainManager.SetProcessor(eth.blockProcessor)
 	eth.whisper = whisper.New()
 
@@ -133,7 +189,7 @@ func New(config *Config) (*Ethereum, error) {
 	insertChain := eth.chainManager.InsertChain
 	eth.blockPool = NewBlockPool(hasBlock, insertChain, ezp.Verify)
 
-	ethProto := EthProtocol(eth.txPool, eth.chainManager, eth.blockPool)
+	ethProto := EthProtocol(chainConfig.ProtocolVersion, chainConfig.NetworkId, eth.txPool, eth.chainManager, eth.blockPool)
 	protocols := []p2p.Protocol{ethProto, eth.whisper.Protocol()}
 
 	nat, err := p2p.ParseNAT(config.NATType, config.PMPGateway)
@@ -197,6 +253,12 @@ func (self *Ethereum) Db() ethutil.Database {
 	return self.db
 }
 
+// TrieCache returns the node cache of the tries of the chain, nil if it's
+// disabled
+func (self *Ethereum) TrieCache() *trie.NodeCache {
+	return self.trieCache
+}
+
 func (s *Ethereum) IsMining() bool {
 	return s.Mining
 }
@@ -237,6 +299,11 @@ func (s *Ethereum) Start(seed bool) error {
 	s.txSub = s.eventMux.Subscribe(core.TxPreEvent{})
 	go s.txBroadcastLoop()
 
+	// Resubmit the local transactions of the previous run
+	if err := s.txPool.LoadJournal(path.Join(s.dataDir, txJournalName)); err != nil {
+		logger.Errorln("couldn't load transaction journal:", err)
+	}
+
 	// broadcast mined blocks
 	s.blockSub = s.eventMux.Subscribe(core.NewMinedBlockEvent{})
 	go s.blockBroadcastLoop()
@@ -265,9 +332,6 @@ func (self *Ethereum) SuggestPeer(addr string) error {
 }
 
 func (s *Ethereum) Stop() {
-	// Close the database
-	defer s.db.Close()
-
 	close(s.quit)
 
 	s.txSub.Unsubscribe()    // quits txBroadcastLoop
@@ -282,11 +346,26 @@ func (s *Ethereum) Stop() {
 	if s.whisper != nil {
 		s.whisper.Stop()
 	}
+	s.Close()
 
 	logger.Infoln("Server stopped")
 	close(s.shutdownChan)
 }
 
+// Close saves the pending candidates of the pruner and closes the database.
+// Stop closes a started node, a node which was never started, such as one
+// importing or exporting the chain, must be closed before exiting.
+func (s *Ethereum) Close() {
+	if s.pruner != nil {
+		s.pruner.Save()
+	}
+	if s.trieCache != nil {
+		logger.Infof("Trie cache: %d hits, %d misses, %d nodes (%d bytes)\n", s.trieCache.Hits(), s.trieCache.Misses(), s.trieCache.Len(), s.trieCache.Size())
+	}
+
+	s.db.Close()
+}
+
 // This function will wait for a shutdown and resumes main thread execution
 func (s *Ethereum) WaitForShutdown() {
 	<-s.shutdownChan
@@ -312,11 +391,11 @@ func (self *Ethereum) blockBroadcastLoop() {
 	}
 }
 
-func saveProtocolVersion(db ethutil.Database) {
+func saveProtocolVersion(db ethutil.Database, version uint32) {
 	d, _ := db.Get([]byte("ProtocolVersion"))
 	protocolVersion := ethutil.NewValue(d).Uint()
 
 	if protocolVersion == 0 {
-		db.Put([]byte("ProtocolVersion"), ethutil.NewValue(ProtocolVersion).Bytes())
+		db.Put([]byte("ProtocolVersion"), ethutil.NewValue(int(version)).Bytes())
 	}
 }
@@ -13,8 +13,8 @@ import (
 )
 
 const (
-	ProtocolVersion    = 51
-	NetworkId          = 0
+	ProtocolVersion    = 51 // protocol version of the default chain configuration
+	NetworkId          = 0  // network id of the default chain configuration
 	ProtocolLength     = uint64(8)
 	ProtocolMaxMsgSize = 10 * 1024 * 1024
 )
@@ -34,6 +34,8 @@ const (
 // ethProtocol represents the ethereum wire protocol
 // instance is running on each peer
 type ethProtocol struct {
+	version      uint32
+	networkId    uint32
 	txPool       txPool
 	chainManager chainManager
 	blockPool    blockPool
@@ -77,21 +79,23 @@ type getBlockHashesMsgData struct {
 // main entrypoint, wrappers starting a server running the eth protocol
 // use this constructor to attach the protocol ("class") to server caps
 // the Dev p2p layer then runs the protocol instance on each peer
-func EthProtocol(txPool txPool, chainManager chainManager, blockPool blockPool) p2p.Protocol {
+func EthProtocol(version, networkId uint32, txPool txPool, chainManager chainManager, blockPool blockPool) p2p.Protocol {
 	return p2p.Protocol{
 		Name:    "eth",
-		Version: ProtocolVersion,
+		Version: uint(version),
 		Length:  ProtocolLength,
 		Run: func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
-			return runEthProtocol(txPool, chainManager, blockPool, peer, rw)
+			return runEthProtocol(version, networkId, txPool, chainManager, blockPool, peer, rw)
 		},
 	}
 }
 
 // the main loop that handles incoming messages
 // note RemovePeer in the post-disconnect hook
-func runEthProtocol(txPool txPool, chainManager chainManager, blockPool blockPool, peer *p2p.Peer, rw p2p.MsgReadWriter) (err error) {
+func runEthProtocol(version, networkId uint32, txPool txPool, chainManager chainManager, blockPool blockPool, peer *p2p.Peer, rw p2p.MsgReadWriter) (err error) {
 	self := &ethProtocol{
+		version:      version,
+		networkId:    networkId,
 		txPool:       txPool,
 		chainManager: chainManager,
 		blockPool:    blockPool,
@@ -239,8 +243,8 @@ func (self *ethProtocol) statusMsg() p2p.Msg {
 	td, currentBlock, genesisBlock := self.chainManager.Status()
 
 	return p2p.NewMsg(StatusMsg,
-		uint32(ProtocolVersion),
-		uint32(NetworkId),
+		self.version,
+		self.networkId,
 		td,
 		currentBlock,
 		genesisBlock,
@@ -278,12 +282,12 @@ func (self *ethProtocol) handleStatus() error {
 		return self.protoError(ErrGenesisBlockMismatch, "%x (!= %x)", status.GenesisBlock, genesisBlock)
 	}
 
-	if status.NetworkId != NetworkId {
-		return self.protoError(ErrNetworkIdMismatch, "%d (!= %d)", status.NetworkId, NetworkId)
+	if status.NetworkId != self.networkId {
+		return self.protoError(ErrNetworkIdMismatch, "%d (!= %d)", status.NetworkId, self.networkId)
 	}
 
-	if ProtocolVersion != status.ProtocolVersion {
-		return self.protoError(ErrProtocolVersionMismatch, "%d (!= %d)", status.ProtocolVersion, ProtocolVersion)
+	if self.version != status.ProtocolVersion {
+		return self.protoError(ErrProtocolVersionMismatch, "%d (!= %d)", status.ProtocolVersion, self.version)
 	}
 
 	self.peer.Infof("Peer is [eth] capable (%d/%d). TD=%v H=%x\n", status.ProtocolVersion, status.NetworkId, status.TD, status.CurrentBlock[:4])
@@ -218,7 +218,7 @@ func (self *ethProtocolTester) checkMsg(i int, code uint64, val interface{}) (ms
 }
 
 func (self *ethProtocolTester) run() {
-	err := runEthProtocol(self.txPool, self.chainManager, self.blockPool, testPeer(), self.rw)
+	err := runEthProtocol(ProtocolVersion, NetworkId, self.txPool, self.chainManager, self.blockPool, testPeer(), self.rw)
 	self.quit <- err
 }
 
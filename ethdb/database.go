@@ -75,6 +75,39 @@ func (self *LDBDatabase) Write(batch *leveldb.Batch) error {
 	return self.db.Write(batch, nil)
 }
 
+// NewBatch returns a batch of writes which are applied atomically, compressed
+// like the writes of Put
+func (self *LDBDatabase) NewBatch() ethutil.Batch {
+	return &ldbBatch{db: self, batch: new(leveldb.Batch)}
+}
+
+type ldbBatch struct {
+	db    *LDBDatabase
+	batch *leveldb.Batch
+}
+
+func (self *ldbBatch) Put(key, value []byte) {
+	if self.db.comp {
+		value = rle.Compress(value)
+	}
+	self.batch.Put(key, value)
+}
+
+func (self *ldbBatch) Delete(key []byte) error {
+	self.batch.Delete(key)
+
+	return nil
+}
+
+func (self *ldbBatch) Write() error {
+	if err := self.db.Write(self.batch); err != nil {
+		return err
+	}
+	self.batch.Reset()
+
+	return nil
+}
+
 func (self *LDBDatabase) Close() {
 	// Close the leveldb database
 	self.db.Close()
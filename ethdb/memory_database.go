@@ -45,6 +45,46 @@ func (db *MemDatabase) Delete(key []byte) error {
 	return nil
 }
 
+// NewBatch returns a batch which applies its puts and deletes in the order
+// they were made on Write
+func (db *MemDatabase) NewBatch() ethutil.Batch {
+	return &memBatch{db: db}
+}
+
+type memBatch struct {
+	db     *MemDatabase
+	writes []memWrite
+}
+
+// memWrite is a put or, if delete is set, a delete of a batch
+type memWrite struct {
+	key, value []byte
+	delete     bool
+}
+
+func (self *memBatch) Put(key, value []byte) {
+	self.writes = append(self.writes, memWrite{key: ethutil.CopyBytes(key), value: ethutil.CopyBytes(value)})
+}
+
+func (self *memBatch) Delete(key []byte) error {
+	self.writes = append(self.writes, memWrite{key: ethutil.CopyBytes(key), delete: true})
+
+	return nil
+}
+
+func (self *memBatch) Write() error {
+	for _, write := range self.writes {
+		if write.delete {
+			self.db.Delete(write.key)
+		} else {
+			self.db.Put(write.key, write.value)
+		}
+	}
+	self.writes = nil
+
+	return nil
+}
+
 func (db *MemDatabase) Print() {
 	for key, val := range db.db {
 		fmt.Printf("%x(%d): ", key, len(key))
@@ -7,6 +7,15 @@ type Database interface {
 	//GetKeys() []*Key
 	Delete(key []byte) error
 	LastKnownTD() []byte
+	NewBatch() Batch
 	Close()
 	Print()
 }
+
+// Batch collects puts and deletes which are applied to the database at once
+// by Write. They can't be read back before they're written.
+type Batch interface {
+	Put(key []byte, value []byte)
+	Delete(key []byte) error
+	Write() error
+}
@@ -1,6 +1,7 @@
 package javascript
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -14,7 +15,6 @@ import (
 	"github.com/ethereum/go-ethereum/ethutil"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/logger"
-	"github.com/ethereum/go-ethereum/state"
 	"github.com/ethereum/go-ethereum/xeth"
 	"github.com/obscuren/otto"
 )
@@ -122,6 +122,8 @@ func (self *JSRE) initStdFuncs() {
 	eth.Set("execBlock", self.execBlock)
 	eth.Set("dump", self.dump)
 	eth.Set("export", self.export)
+	eth.Set("traceTransaction", self.traceTransaction)
+	eth.Set("traceCalls", self.traceCalls)
 }
 
 /*
@@ -152,7 +154,12 @@ func (self *JSRE) dump(call otto.FunctionCall) otto.Value {
 		block = self.ethereum.ChainManager().CurrentBlock()
 	}
 
-	statedb := state.New(block.Root(), self.ethereum.Db())
+	statedb, err := self.ethereum.ChainManager().StateAt(block.Root())
+	if err != nil {
+		fmt.Println(err)
+
+		return otto.UndefinedValue()
+	}
 	v, _ := self.Vm.ToValue(statedb.Dump())
 
 	return v
@@ -244,12 +251,52 @@ func (self *JSRE) export(call otto.FunctionCall) otto.Value {
 		return otto.FalseValue()
 	}
 
-	data := self.ethereum.ChainManager().Export()
-
-	if err := ethutil.WriteFile(fn, data); err != nil {
+	if err := utils.ExportChain(self.ethereum.ChainManager(), fn); err != nil {
 		fmt.Println(err)
 		return otto.FalseValue()
 	}
 
 	return otto.TrueValue()
 }
+
+func (self *JSRE) traceTransaction(call otto.FunctionCall) otto.Value {
+	hash, err := call.Argument(0).ToString()
+	if err != nil {
+		return otto.UndefinedValue()
+	}
+
+	trace, err := self.pipe.TraceTransaction(hash)
+	if err != nil {
+		fmt.Println(err)
+		return otto.UndefinedValue()
+	}
+
+	return self.toJSObject(trace)
+}
+
+func (self *JSRE) traceCalls(call otto.FunctionCall) otto.Value {
+	hash, err := call.Argument(0).ToString()
+	if err != nil {
+		return otto.UndefinedValue()
+	}
+
+	calls, err := self.pipe.TraceCalls(hash)
+	if err != nil {
+		fmt.Println(err)
+		return otto.UndefinedValue()
+	}
+
+	return self.toJSObject(calls)
+}
+
+// toJSObject converts v to a javascript object through its JSON encoding
+func (self *JSRE) toJSObject(v interface{}) otto.Value {
+	enc, err := json.Marshal(v)
+	if err != nil {
+		fmt.Println(err)
+		return otto.UndefinedValue()
+	}
+	obj, _ := self.Vm.Run("(" + string(enc) + ")")
+
+	return obj
+}
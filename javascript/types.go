@@ -19,9 +19,10 @@ type JSStateObject struct {
 func (self *JSStateObject) EachStorage(call otto.FunctionCall) otto.Value {
 	cb := call.Argument(0)
 
-	it := self.JSObject.Trie().Iterator()
+	storage := self.JSObject.Trie()
+	it := storage.Iterator()
 	for it.Next() {
-		cb.Call(self.eth.toVal(self), self.eth.toVal(ethutil.Bytes2Hex(it.Key)), self.eth.toVal(ethutil.Bytes2Hex(it.Value)))
+		cb.Call(self.eth.toVal(self), self.eth.toVal(ethutil.Bytes2Hex(storage.GetKey(it.Key))), self.eth.toVal(ethutil.Bytes2Hex(it.Value)))
 	}
 
 	return otto.UndefinedValue()
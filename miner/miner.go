@@ -25,13 +25,11 @@ package miner
 
 import (
 	"math/big"
-	"sort"
 
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/ethutil"
 	"github.com/ethereum/go-ethereum/pow"
 	"github.com/ethereum/go-ethereum/pow/ezp"
-	"github.com/ethereum/go-ethereum/state"
 
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -47,8 +45,13 @@ type LocalTx struct {
 	Value    string `json:"value"`
 }
 
-func (self *LocalTx) Sign(key []byte) *types.Transaction {
-	return nil
+// Sign creates the transaction described by self with the given nonce
+func (self *LocalTx) Sign(nonce uint64, key []byte) *types.Transaction {
+	tx := types.NewTransactionMessage(self.To, ethutil.Big(self.Value), ethutil.Big(self.Gas), ethutil.Big(self.GasPrice), self.Data)
+	tx.SetNonce(nonce)
+	tx.Sign(key)
+
+	return tx
 }
 
 var minerlogger = logger.NewLogger("MINER")
@@ -58,7 +61,7 @@ type Miner struct {
 	events event.Subscription
 
 	uncles    []*types.Header
-	localTxs  map[int]*LocalTx
+	localTxs  map[int]*types.Transaction
 	localTxId int
 
 	pow       pow.PoW
@@ -79,7 +82,7 @@ func New(coinbase []byte, eth *eth.Ethereum) *Miner {
 		powQuitCh:           make(chan struct{}),
 		pow:                 ezp.New(),
 		mining:              false,
-		localTxs:            make(map[int]*LocalTx),
+		localTxs:            make(map[int]*types.Transaction),
 		MinAcceptedGasPrice: big.NewInt(10000000000000),
 		Coinbase:            coinbase,
 	}
@@ -89,19 +92,32 @@ func (self *Miner) GetPow() pow.PoW {
 	return self.pow
 }
 
-func (self *Miner) AddLocalTx(tx *LocalTx) int {
-	minerlogger.Infof("Added local tx (%x %v / %v)\n", tx.To[0:4], tx.GasPrice, tx.Value)
+// AddLocalTx signs ltx with the coinbase key and submits it to the pool as a
+// local transaction. It returns the id of the transaction or 0 if the pool
+// rejected it.
+func (self *Miner) AddLocalTx(ltx *LocalTx) int {
+	// XXX This has to change. Coinbase is, for new, same as key.
+	// The pending local transactions of the coinbase aren't mined yet, the
+	// nonce follows them.
+	nonce := self.eth.TxPool().PendingNonce(self.Coinbase)
+	tx := ltx.Sign(nonce, self.eth.KeyManager().PrivateKey())
+
+	if err := self.eth.TxPool().AddLocal(tx); err != nil {
+		minerlogger.Infof("Local tx (%x %v / %v) rejected: %v\n", ltx.To[0:4], ltx.GasPrice, ltx.Value, err)
+		return 0
+	}
+	minerlogger.Infof("Added local tx (%x %v / %v)\n", ltx.To[0:4], ltx.GasPrice, ltx.Value)
 
 	self.localTxId++
 	self.localTxs[self.localTxId] = tx
-	self.eth.EventMux().Post(tx)
 
 	return self.localTxId
 }
 
 func (self *Miner) RemoveLocalTx(id int) {
 	if tx := self.localTxs[id]; tx != nil {
-		minerlogger.Infof("Removed local tx (%x %v / %v)\n", tx.To[0:4], tx.GasPrice, tx.Value)
+		minerlogger.Infof("Removed local tx (%x %v / %v)\n", tx.To()[0:4], tx.GasPrice(), tx.Value())
+		self.eth.TxPool().RemoveSet(types.Transactions{tx})
 	}
 	self.eth.EventMux().Post(&LocalTx{})
 
@@ -179,8 +195,12 @@ func (self *Miner) mine() {
 		blockProcessor = self.eth.BlockProcessor()
 		chainMan       = self.eth.ChainManager()
 		block          = chainMan.NewBlock(self.Coinbase)
-		state          = state.New(block.Root(), self.eth.Db())
 	)
+	state, err := chainMan.StateAt(block.Root())
+	if err != nil {
+		minerlogger.Errorln(err)
+		return
+	}
 	block.Header().Extra = self.Extra
 
 	// Apply uncles
@@ -190,7 +210,7 @@ func (self *Miner) mine() {
 
 	parent := chainMan.GetBlock(block.ParentHash())
 	coinbase := state.GetOrNewStateObject(block.Coinbase())
-	coinbase.SetGasPool(core.CalcGasLimit(parent, block))
+	coinbase.SetGasPool(chainMan.Config().CalcGasLimit(parent, block))
 
 	transactions := self.finiliseTxs()
 
@@ -232,26 +252,15 @@ func (self *Miner) mine() {
 }
 
 func (self *Miner) finiliseTxs() types.Transactions {
-	// Sort the transactions by nonce in case of odd network propagation
-	actualSize := len(self.localTxs) // See copy below
-	txs := make(types.Transactions, actualSize+self.eth.TxPool().Size())
-
-	state := self.eth.ChainManager().TransState()
-	// XXX This has to change. Coinbase is, for new, same as key.
-	key := self.eth.KeyManager()
-	for i, ltx := range self.localTxs {
-		tx := types.NewTransactionMessage(ltx.To, ethutil.Big(ltx.Value), ethutil.Big(ltx.Gas), ethutil.Big(ltx.GasPrice), ltx.Data)
-		tx.SetNonce(state.GetNonce(self.Coinbase))
-		state.SetNonce(self.Coinbase, tx.Nonce()+1)
-
-		tx.Sign(key.PrivateKey())
-
-		txs[i] = tx
-	}
-
-	// Faster than append
-	for _, tx := range self.eth.TxPool().GetTransactions() {
-		if tx.GasPrice().Cmp(self.MinAcceptedGasPrice) >= 0 {
+	// The pool hands out the executable transactions ordered by nonce
+	pool := self.eth.TxPool()
+	pending := pool.Pending()
+	actualSize := 0 // See copy below
+	txs := make(types.Transactions, len(pending))
+
+	// Faster than append. Local transactions aren't subject to the price floor.
+	for _, tx := range pending {
+		if tx.GasPrice().Cmp(self.MinAcceptedGasPrice) >= 0 || pool.IsLocal(tx) {
 			txs[actualSize] = tx
 			actualSize++
 		}
@@ -259,7 +268,6 @@ func (self *Miner) finiliseTxs() types.Transactions {
 
 	newTransactions := make(types.Transactions, actualSize)
 	copy(newTransactions, txs[:actualSize])
-	sort.Sort(types.TxByNonce{newTransactions})
 
 	return newTransactions
 }
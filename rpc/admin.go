@@ -0,0 +1,31 @@
+package rpc
+
+import "github.com/ethereum/go-ethereum/xeth"
+
+// AdminApi holds the calls administering the local node, such as rewinding
+// the chain. They aren't part of EthereumApi and are only served when the
+// server is started with the admin API enabled.
+type AdminApi struct {
+	pipe *xeth.JSXEth
+}
+
+type SetHeadArgs struct {
+	Number int `json:"number"`
+}
+
+type SetHeadRes struct {
+	Number int    `json:"number"`
+	Hash   string `json:"hash"`
+}
+
+// SetHead rewinds the chain to the given block, the blocks above it are
+// deleted
+func (p *AdminApi) SetHead(args *SetHeadArgs, reply *string) error {
+	if err := p.pipe.SetHead(args.Number); err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	head := p.pipe.BlockByNumber(-1)
+	*reply = NewSuccessRes(SetHeadRes{Number: head.Number, Hash: head.Hash})
+	return nil
+}
@@ -74,11 +74,83 @@ func (p *EthereumApi) GetBlock(args *GetBlockArgs, reply *string) error {
 		return err
 	}
 
-	block := p.pipe.BlockByHash(args.Hash)
+	var block *xeth.JSBlock
+	if args.Hash != "" {
+		block = p.pipe.BlockByHash(args.Hash)
+	} else {
+		block = p.pipe.BlockByNumber(int32(args.BlockNumber))
+	}
 	*reply = NewSuccessRes(block)
 	return nil
 }
 
+type GetTxArgs struct {
+	Hash string `json:"hash"`
+}
+
+func (a *GetTxArgs) requirements() error {
+	if a.Hash == "" {
+		return NewErrorResponse("GetTransaction requires a 'hash' value as argument")
+	}
+	return nil
+}
+
+func (p *EthereumApi) GetTransaction(args *GetTxArgs, reply *string) error {
+	err := args.requirements()
+	if err != nil {
+		return err
+	}
+
+	tx := p.pipe.Transaction(args.Hash)
+	if tx == nil {
+		return NewErrorResponse("Transaction not found")
+	}
+	*reply = NewSuccessRes(tx)
+	return nil
+}
+
+func (p *EthereumApi) GetReceipt(args *GetTxArgs, reply *string) error {
+	err := args.requirements()
+	if err != nil {
+		return err
+	}
+
+	receipt := p.pipe.Receipt(args.Hash)
+	if receipt == nil {
+		return NewErrorResponse("Receipt not found")
+	}
+	*reply = NewSuccessRes(receipt)
+	return nil
+}
+
+func (p *EthereumApi) TraceTransaction(args *GetTxArgs, reply *string) error {
+	err := args.requirements()
+	if err != nil {
+		return err
+	}
+
+	trace, err := p.pipe.TraceTransaction(args.Hash)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	*reply = NewSuccessRes(trace)
+	return nil
+}
+
+func (p *EthereumApi) TraceCalls(args *GetTxArgs, reply *string) error {
+	err := args.requirements()
+	if err != nil {
+		return err
+	}
+
+	calls, err := p.pipe.TraceCalls(args.Hash)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	*reply = NewSuccessRes(calls)
+	return nil
+}
+
 type NewTxArgs struct {
 	Sec       string
 	Recipient string
@@ -129,7 +201,10 @@ func (p *EthereumApi) Transact(args *NewTxArgs, reply *string) error {
 	if err != nil {
 		return err
 	}
-	result, _ := p.pipe.Transact(p.pipe.Key().PrivateKey, args.Recipient, args.Value, args.Gas, args.GasPrice, args.Body)
+	result, err := p.pipe.Transact(p.pipe.Key().PrivateKey, args.Recipient, args.Value, args.Gas, args.GasPrice, args.Body)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
 	*reply = NewSuccessRes(result)
 	return nil
 }
@@ -140,7 +215,10 @@ func (p *EthereumApi) Create(args *NewTxArgs, reply *string) error {
 		return err
 	}
 
-	result, _ := p.pipe.Transact(p.pipe.Key().PrivateKey, "", args.Value, args.Gas, args.GasPrice, args.Body)
+	result, err := p.pipe.Transact(p.pipe.Key().PrivateKey, "", args.Value, args.Gas, args.GasPrice, args.Body)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
 	*reply = NewSuccessRes(result)
 	return nil
 }
@@ -161,7 +239,10 @@ func (p *EthereumApi) PushTx(args *PushTxArgs, reply *string) error {
 	if err != nil {
 		return err
 	}
-	result, _ := p.pipe.PushTx(args.Tx)
+	result, err := p.pipe.PushTx(args.Tx)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
 	*reply = NewSuccessRes(result)
 	return nil
 }
@@ -174,6 +255,7 @@ func (p *EthereumApi) GetKey(args interface{}, reply *string) error {
 type GetStorageArgs struct {
 	Address string
 	Key     string
+	Block   string
 }
 
 func (a *GetStorageArgs) requirements() error {
@@ -198,7 +280,10 @@ func (p *EthereumApi) GetStorageAt(args *GetStorageArgs, reply *string) error {
 		return err
 	}
 
-	state := p.pipe.World().SafeGet(ethutil.Hex2Bytes(args.Address))
+	state, err := p.pipe.World().SafeGetAt(ethutil.Hex2Bytes(args.Address), args.Block)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
 
 	var hx string
 	if strings.Index(args.Key, "0x") == 0 {
@@ -214,8 +299,66 @@ func (p *EthereumApi) GetStorageAt(args *GetStorageArgs, reply *string) error {
 	return nil
 }
 
+type GetProofArgs struct {
+	Address string   `json:"address"`
+	Keys    []string `json:"keys"`
+	Block   string   `json:"block"`
+}
+
+func (a *GetProofArgs) requirements() error {
+	if a.Address == "" {
+		return NewErrorResponse("GetProof requires an 'address' value as argument")
+	}
+	return nil
+}
+
+// GetProof returns an account with the merkle proofs of the account and of
+// its storage slots at the given hex keys
+func (p *EthereumApi) GetProof(args *GetProofArgs, reply *string) error {
+	err := args.requirements()
+	if err != nil {
+		return err
+	}
+
+	proof, err := p.pipe.ProofAtBlock(args.Address, args.Keys, args.Block)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	*reply = NewSuccessRes(proof)
+	return nil
+}
+
+type GetStateDiffArgs struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (a *GetStateDiffArgs) requirements() error {
+	if a.From == "" || a.To == "" {
+		return NewErrorResponse("GetStateDiff requires a 'from' and a 'to' block as arguments")
+	}
+	return nil
+}
+
+// GetStateDiff returns the accounts and storage slots changed between the
+// states of two blocks
+func (p *EthereumApi) GetStateDiff(args *GetStateDiffArgs, reply *string) error {
+	err := args.requirements()
+	if err != nil {
+		return err
+	}
+
+	diff, err := p.pipe.StateDiff(args.From, args.To)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	*reply = NewSuccessRes(diff)
+	return nil
+}
+
 type GetTxCountArgs struct {
 	Address string `json:"address"`
+	Block   string `json:"block"`
 }
 type GetTxCountRes struct {
 	Nonce int `json:"nonce"`
@@ -269,13 +412,17 @@ func (p *EthereumApi) GetTxCountAt(args *GetTxCountArgs, reply *string) error {
 	if err != nil {
 		return err
 	}
-	state := p.pipe.TxCountAt(args.Address)
-	*reply = NewSuccessRes(GetTxCountRes{Nonce: state})
+	count, err := p.pipe.TxCountAtBlock(args.Address, args.Block)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	*reply = NewSuccessRes(GetTxCountRes{Nonce: count})
 	return nil
 }
 
 type GetBalanceArgs struct {
 	Address string
+	Block   string
 }
 
 func (a *GetBalanceArgs) requirements() error {
@@ -295,7 +442,10 @@ func (p *EthereumApi) GetBalanceAt(args *GetBalanceArgs, reply *string) error {
 	if err != nil {
 		return err
 	}
-	state := p.pipe.World().SafeGet(ethutil.Hex2Bytes(args.Address))
+	state, err := p.pipe.World().SafeGetAt(ethutil.Hex2Bytes(args.Address), args.Block)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
 	*reply = NewSuccessRes(BalanceRes{Balance: state.Balance().String(), Address: args.Address})
 	return nil
 }
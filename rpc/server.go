@@ -16,6 +16,7 @@ type JsonRpcServer struct {
 	quit     chan bool
 	listener net.Listener
 	pipe     *xeth.JSXEth
+	admin    bool
 }
 
 func (s *JsonRpcServer) exitHandler() {
@@ -39,6 +40,10 @@ func (s *JsonRpcServer) Start() {
 	jsonlogger.Infoln("Starting JSON-RPC server")
 	go s.exitHandler()
 	rpc.Register(&EthereumApi{pipe: s.pipe})
+	if s.admin {
+		jsonlogger.Infoln("Admin API enabled")
+		rpc.Register(&AdminApi{pipe: s.pipe})
+	}
 	rpc.HandleHTTP()
 
 	for {
@@ -52,7 +57,9 @@ func (s *JsonRpcServer) Start() {
 	}
 }
 
-func NewJsonRpcServer(pipe *xeth.JSXEth, port int) (*JsonRpcServer, error) {
+// NewJsonRpcServer creates a server listening on port. The admin API, which
+// can modify the local chain, is only served if admin is set.
+func NewJsonRpcServer(pipe *xeth.JSXEth, port int, admin bool) (*JsonRpcServer, error) {
 	sport := fmt.Sprintf(":%d", port)
 	l, err := net.Listen("tcp", sport)
 	if err != nil {
@@ -63,5 +70,6 @@ func NewJsonRpcServer(pipe *xeth.JSXEth, port int) (*JsonRpcServer, error) {
 		listener: l,
 		quit:     make(chan bool),
 		pipe:     pipe,
+		admin:    admin,
 	}, nil
 }
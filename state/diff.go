@@ -0,0 +1,87 @@
+package state
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/ethutil"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// AccountDiff is an account that changed between two states. An account
+// missing from one of the states has a zero balance and nonce and no code
+// hash there.
+type AccountDiff struct {
+	Address []byte
+
+	OldBalance, NewBalance   *big.Int
+	OldNonce, NewNonce       uint64
+	OldCodeHash, NewCodeHash []byte
+
+	Storage []*StorageDiff
+}
+
+// StorageDiff is a storage slot that changed between two states, a value is
+// nil if the slot is empty
+type StorageDiff struct {
+	Key, Old, New []byte
+}
+
+// Diff returns the accounts and storage slots that differ between the
+// committed tries of from and to, in the order of their trie keys. Both
+// states must be in the same trie mode. Subtrees shared by both states
+// aren't loaded.
+func Diff(from, to *StateDB) []*AccountDiff {
+	var diffs []*AccountDiff
+
+	it := trie.NewDiffIterator(plainTrie(from.trie), plainTrie(to.trie))
+	for it.Next() {
+		// The key is in one of the tries, which holds its preimage if the
+		// tries are secure
+		addr := from.trie.GetKey(it.Key)
+		if addr == nil {
+			addr = to.trie.GetKey(it.Key)
+		}
+
+		old, cur := from.diffObject(addr, it.Old), to.diffObject(addr, it.New)
+		diff := &AccountDiff{
+			Address:     addr,
+			OldBalance:  old.balance,
+			NewBalance:  cur.balance,
+			OldNonce:    old.Nonce,
+			NewNonce:    cur.Nonce,
+			OldCodeHash: old.codeHash,
+			NewCodeHash: cur.codeHash,
+		}
+
+		storage := trie.NewDiffIterator(plainTrie(old.State.trie), plainTrie(cur.State.trie))
+		for storage.Next() {
+			key := old.State.trie.GetKey(storage.Key)
+			if key == nil {
+				key = cur.State.trie.GetKey(storage.Key)
+			}
+			diff.Storage = append(diff.Storage, &StorageDiff{Key: key, Old: storageValue(storage.Old), New: storageValue(storage.New)})
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	return diffs
+}
+
+// diffObject decodes an account of a state diff, data is empty for accounts
+// missing from the state
+func (self *StateDB) diffObject(addr, data []byte) *StateObject {
+	if len(data) == 0 {
+		return newStateObject(addr, self.db, self.secure)
+	}
+
+	return newStateObjectFromBytes(addr, data, self.db, self.secure)
+}
+
+func storageValue(data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return ethutil.NewValueFromBytes(data).Bytes()
+}
@@ -18,26 +18,43 @@ type Account struct {
 type World struct {
 	Root     string             `json:"root"`
 	Accounts map[string]Account `json:"accounts"`
+	// Trie key of the account a ranged dump continues at, empty if there
+	// are no more accounts
+	Next string `json:"next,omitempty"`
 }
 
 func (self *StateDB) Dump() []byte {
+	return self.DumpRange(nil, 0)
+}
+
+// DumpRange dumps at most max accounts, or every account if max is 0,
+// starting at the trie key start. The trie keys of a secure state are the
+// hashes of the addresses.
+func (self *StateDB) DumpRange(start []byte, max int) []byte {
 	world := World{
 		Root:     ethutil.Bytes2Hex(self.trie.Root()),
 		Accounts: make(map[string]Account),
 	}
 
 	it := self.trie.Iterator()
+	it.Seek(start)
 	for it.Next() {
-		stateObject := NewStateObjectFromBytes(it.Key, it.Value, self.db)
+		if max > 0 && len(world.Accounts) == max {
+			world.Next = ethutil.Bytes2Hex(it.Key)
+			break
+		}
+
+		addr := self.trie.GetKey(it.Key)
+		stateObject := newStateObjectFromBytes(addr, it.Value, self.db, self.secure)
 
 		account := Account{Balance: stateObject.balance.String(), Nonce: stateObject.Nonce, Root: ethutil.Bytes2Hex(stateObject.Root()), CodeHash: ethutil.Bytes2Hex(stateObject.codeHash)}
 		account.Storage = make(map[string]string)
 
 		storageIt := stateObject.State.trie.Iterator()
 		for storageIt.Next() {
-			account.Storage[ethutil.Bytes2Hex(it.Key)] = ethutil.Bytes2Hex(it.Value)
+			account.Storage[ethutil.Bytes2Hex(stateObject.State.trie.GetKey(storageIt.Key))] = ethutil.Bytes2Hex(storageIt.Value)
 		}
-		world.Accounts[ethutil.Bytes2Hex(it.Key)] = account
+		world.Accounts[ethutil.Bytes2Hex(addr)] = account
 	}
 
 	json, err := json.MarshalIndent(world, "", "    ")
@@ -53,6 +70,6 @@ func (self *StateObject) CreateOutputForDiff() {
 	fmt.Printf("%x %x %x %x\n", self.Address(), self.State.Root(), self.balance.Bytes(), self.Nonce)
 	it := self.State.trie.Iterator()
 	for it.Next() {
-		fmt.Printf("%x %x\n", it.Key, it.Value)
+		fmt.Printf("%x %x\n", self.State.trie.GetKey(it.Key), it.Value)
 	}
 }
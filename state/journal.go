@@ -0,0 +1,100 @@
+package state
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/ethutil"
+)
+
+// journalEntry is a single change of the state that can be undone
+type journalEntry interface {
+	undo(*StateDB)
+}
+
+// journal records the changes made to a StateDB so they can be reverted to
+// any snapshot without copying the state
+type journal []journalEntry
+
+type (
+	// An object was created, replacing prev if there was one
+	createObjectChange struct {
+		addr string
+		prev *StateObject
+	}
+	balanceChange struct {
+		object *StateObject
+		prev   *big.Int
+	}
+	nonceChange struct {
+		object *StateObject
+		prev   uint64
+	}
+	codeChange struct {
+		object *StateObject
+		prev   Code
+	}
+	// A storage slot was set, prev is nil if the slot wasn't cached
+	storageChange struct {
+		object *StateObject
+		key    string
+		prev   *ethutil.Value
+	}
+	suicideChange struct {
+		object *StateObject
+		prev   bool
+	}
+	addLogChange struct {
+		prevLen int
+	}
+	// A refund was added, prev is nil if there was no refund yet
+	refundChange struct {
+		addr string
+		prev *big.Int
+	}
+)
+
+func (self createObjectChange) undo(statedb *StateDB) {
+	if self.prev == nil {
+		delete(statedb.stateObjects, self.addr)
+	} else {
+		statedb.stateObjects[self.addr] = self.prev
+	}
+}
+
+func (self balanceChange) undo(*StateDB) {
+	self.object.balance = self.prev
+}
+
+func (self nonceChange) undo(*StateDB) {
+	self.object.Nonce = self.prev
+}
+
+func (self codeChange) undo(*StateDB) {
+	self.object.Code = self.prev
+}
+
+func (self storageChange) undo(*StateDB) {
+	if self.prev == nil {
+		delete(self.object.storage, self.key)
+	} else {
+		self.object.storage[self.key] = self.prev
+	}
+}
+
+func (self suicideChange) undo(*StateDB) {
+	self.object.remove = self.prev
+}
+
+func (self addLogChange) undo(statedb *StateDB) {
+	if len(statedb.logs) > self.prevLen {
+		statedb.logs = statedb.logs[:self.prevLen]
+	}
+}
+
+func (self refundChange) undo(statedb *StateDB) {
+	if self.prev == nil {
+		delete(statedb.refund, self.addr)
+	} else {
+		statedb.refund[self.addr] = self.prev
+	}
+}
@@ -0,0 +1,226 @@
+package state
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethutil"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Database keys under which the pending candidates and the head of the last
+// sweep are kept across restarts
+var (
+	prunerCandidatesKey = []byte("PrunerCandidates")
+	prunerLastKey       = []byte("PrunerLastSweep")
+)
+
+// Pruner is a database deleting the trie nodes and contract code that are no
+// longer part of the state of the most recent blocks. Every key written
+// through it is a candidate for deletion. Periodically the nodes reachable
+// from the retained state roots are marked and the unmarked candidates
+// written before the retained blocks are swept.
+//
+// States older than the retained blocks can't be opened once swept.
+type Pruner struct {
+	ethutil.Database
+
+	retain uint64
+	nodes  *trie.NodeCache // shared by the tries opened on the pruner
+
+	mu         sync.Mutex
+	head       uint64            // number of the current head block
+	last       uint64            // head at the last sweep
+	candidates map[string]uint64 // keys written by the head at write time
+}
+
+// NewPruner creates a pruner keeping the state of the last retain blocks and
+// loads the candidates and the last sweep left by the previous run. The tries
+// opened on the pruner share nodes, which may be nil, with the other tries of
+// db.
+func NewPruner(db ethutil.Database, retain uint64, nodes *trie.NodeCache) *Pruner {
+	pruner := &Pruner{Database: db, retain: retain, nodes: nodes, candidates: make(map[string]uint64)}
+
+	if data, _ := db.Get(prunerCandidatesKey); len(data) > 0 {
+		decoder := ethutil.NewValueFromBytes(data)
+		for i := 0; i < decoder.Len(); i++ {
+			candidate := decoder.Get(i)
+			pruner.candidates[string(candidate.Get(0).Bytes())] = candidate.Get(1).Uint()
+		}
+	}
+	if data, _ := db.Get(prunerLastKey); len(data) > 0 {
+		pruner.last = ethutil.NewValueFromBytes(data).Uint()
+		pruner.head = pruner.last
+	}
+	statelogger.Infof("Pruning state older than %d blocks, %d candidate(s) pending\n", retain, len(pruner.candidates))
+
+	return pruner
+}
+
+// Put writes the key and makes it a candidate for deletion if it's the hash
+// of a trie node or code. Other keys, such as the key preimages of secure
+// tries, are kept.
+func (self *Pruner) Put(key, value []byte) {
+	self.track(key)
+	self.Database.Put(key, value)
+}
+
+// NewBatch returns a batch of the database whose puts are candidates for
+// deletion like those of Put
+func (self *Pruner) NewBatch() ethutil.Batch {
+	return self.Track(self.Database.NewBatch())
+}
+
+// Track returns a batch writing to batch whose puts are candidates for
+// deletion like those of Put. It lets the state of a block be written in the
+// same batch as the block itself, whose keys must not be deleted.
+func (self *Pruner) Track(batch ethutil.Batch) ethutil.Batch {
+	return &prunerBatch{batch, self}
+}
+
+func (self *Pruner) track(key []byte) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if len(key) == 32 {
+		self.candidates[string(key)] = self.head
+	}
+}
+
+type prunerBatch struct {
+	ethutil.Batch
+	pruner *Pruner
+}
+
+func (self *prunerBatch) Put(key, value []byte) {
+	self.pruner.track(key)
+	self.Batch.Put(key, value)
+}
+
+// NodeCache returns the node cache shared by the tries opened on the pruner
+func (self *Pruner) NodeCache() *trie.NodeCache {
+	return self.nodes
+}
+
+// Retain returns the number of recent blocks whose state is kept
+func (self *Pruner) Retain() uint64 {
+	return self.retain
+}
+
+// Oldest returns the number of the oldest block whose state is kept, the
+// first of the blocks retained by the last sweep
+func (self *Pruner) Oldest() uint64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.last+1 < self.retain {
+		return 0
+	}
+
+	return self.last + 1 - self.retain
+}
+
+// SetHead records the number of the new head block and reports whether a
+// sweep is due, which is once every retain blocks. The head moves back when
+// the chain is rewound.
+func (self *Pruner) SetHead(number uint64) bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.head = number
+
+	return number >= self.last+self.retain
+}
+
+// Sweep deletes the candidates written before the retained blocks that are
+// no longer reachable from roots, the state roots of the retained blocks. It
+// returns the number of deleted keys.
+//
+// The roots are marked without holding the lock, state keeps being written
+// meanwhile. Keys written during the mark are written by blocks after the
+// retained ones, they aren't deleted.
+func (self *Pruner) Sweep(roots [][]byte) int {
+	start := time.Now()
+
+	self.mu.Lock()
+	head := self.head
+	self.mu.Unlock()
+
+	marked := make(map[string]bool)
+	for _, root := range roots {
+		self.mark(root, marked)
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var deleted int
+	batch := self.Database.NewBatch()
+	for key, number := range self.candidates {
+		// Keys written by the retained blocks may belong to states that
+		// aren't canonical yet. Reachable keys aren't written again unless
+		// they change, they stay candidates until they're unreachable.
+		if number+self.retain > head || marked[key] {
+			continue
+		}
+		batch.Delete([]byte(key))
+		delete(self.candidates, key)
+		deleted++
+	}
+	// Sweeps of successive heads may overlap, the last sweep is the highest
+	if head > self.last {
+		self.last = head
+	}
+	batch.Put(prunerLastKey, ethutil.Encode(self.last))
+	if err := batch.Write(); err != nil {
+		statelogger.Errorln("prune failed:", err)
+	}
+
+	statelogger.Infof("Pruned %d state entries in %v, %d candidate(s) left\n", deleted, time.Since(start), len(self.candidates))
+
+	return deleted
+}
+
+// uncachedBackend hides the node cache of a database from the tries opened on
+// it
+type uncachedBackend struct {
+	trie.Backend
+}
+
+// mark marks the nodes of the account trie with the given root, the nodes of
+// the storage tries of its accounts and their code. The nodes are read from
+// the database itself, walking whole states through the node cache would
+// evict the nodes of the recent blocks from it.
+func (self *Pruner) mark(root []byte, marked map[string]bool) {
+	db := uncachedBackend{self.Database}
+
+	visit := func(hash []byte) bool {
+		if marked[string(hash)] {
+			return false
+		}
+		marked[string(hash)] = true
+
+		return true
+	}
+
+	trie.New(root, db).Walk(visit, func(value []byte) {
+		account := ethutil.NewValueFromBytes(value)
+		marked[string(account.Get(3).Bytes())] = true
+
+		if storageRoot := account.Get(2).Bytes(); len(storageRoot) > 0 {
+			trie.New(storageRoot, db).Walk(visit, func([]byte) {})
+		}
+	})
+}
+
+// Save persists the pending candidates so they can be swept after a restart
+func (self *Pruner) Save() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	candidates := make([]interface{}, 0, len(self.candidates))
+	for key, number := range self.candidates {
+		candidates = append(candidates, []interface{}{[]byte(key), number})
+	}
+	self.Database.Put(prunerCandidatesKey, ethutil.Encode(candidates))
+}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethutil"
-	"github.com/ethereum/go-ethereum/trie"
 )
 
 type Code []byte
@@ -39,8 +38,13 @@ type StateObject struct {
 	State    *StateDB
 	Code     Code
 	InitCode Code
+	// Whether the storage trie is a secure trie
+	secure bool
 
 	storage Storage
+	// Storage slots set since the last Sync, only these are written back to
+	// the storage trie
+	dirtyStorage map[string]bool
 
 	// Total gas pool is the total amount of gas currently
 	// left if this object is the coinbase. Gas is directly
@@ -51,33 +55,53 @@ type StateObject struct {
 	// When an object is marked for deletion it will be delete from the trie
 	// during the "update" phase of the state transition
 	remove bool
+
+	// Set by every change, only dirty objects are written to the state trie
+	dirty bool
+
+	// Journal of the StateDB holding this object, changes are recorded in it
+	// so they can be reverted. Objects outside of a StateDB have none.
+	journal *journal
 }
 
 func (self *StateObject) Reset() {
 	self.storage = make(Storage)
+	self.dirtyStorage = make(map[string]bool)
 	self.State.Reset()
 }
 
 func NewStateObject(addr []byte, db ethutil.Database) *StateObject {
+	return newStateObject(addr, db, false)
+}
+
+// newStateObject creates an object whose storage trie is a secure trie if
+// secure is set
+func newStateObject(addr []byte, db ethutil.Database, secure bool) *StateObject {
 	// This to ensure that it has 20 bytes (and not 0 bytes), thus left or right pad doesn't matter.
 	address := ethutil.Address(addr)
 
-	object := &StateObject{db: db, address: address, balance: new(big.Int), gasPool: new(big.Int)}
-	object.State = New(nil, db) //New(trie.New(ethutil.Config.Db, ""))
+	object := &StateObject{db: db, address: address, balance: new(big.Int), gasPool: new(big.Int), dirty: true, secure: secure}
+	object.State = newState(nil, db, secure) //New(trie.New(ethutil.Config.Db, ""))
 	object.storage = make(Storage)
+	object.dirtyStorage = make(map[string]bool)
 	object.gasPool = new(big.Int)
 
 	return object
 }
 
 func NewStateObjectFromBytes(address, data []byte, db ethutil.Database) *StateObject {
-	object := &StateObject{address: address, db: db}
+	return newStateObjectFromBytes(address, data, db, false)
+}
+
+func newStateObjectFromBytes(address, data []byte, db ethutil.Database, secure bool) *StateObject {
+	object := &StateObject{address: address, db: db, secure: secure}
 	object.RlpDecode(data)
 
 	return object
 }
 
 func (self *StateObject) MarkForDeletion() {
+	self.record(suicideChange{object: self, prev: self.remove})
 	self.remove = true
 	statelogger.DebugDetailf("%x: #%d %v (deletion)\n", self.Address(), self.Nonce, self.balance)
 }
@@ -97,6 +121,31 @@ func (self *StateObject) SetStorage(key *big.Int, value *ethutil.Value) {
 	self.SetState(key.Bytes(), value)
 }
 
+// ProveStorage returns a merkle proof of the storage slot key, or of its
+// absence, against Root. Slots set since the last Sync aren't part of it.
+func (self *StateObject) ProveStorage(key *big.Int) [][]byte {
+	return self.State.trie.Prove(ethutil.LeftPadBytes(key.Bytes(), 32))
+}
+
+// StorageRange returns at most max slots of the storage trie, or every slot if
+// max is 0, starting at the trie key start. The slots are keyed by their
+// original keys. It also returns the trie key of the slot to continue at, nil
+// if there are no more. Slots set since the last Sync aren't included.
+func (self *StateObject) StorageRange(start []byte, max int) (Storage, []byte) {
+	storage := make(Storage)
+
+	it := self.State.trie.Iterator()
+	it.Seek(start)
+	for it.Next() {
+		if max > 0 && len(storage) == max {
+			return storage, it.Key
+		}
+		storage[string(self.State.trie.GetKey(it.Key))] = ethutil.NewValueFromBytes(it.Value)
+	}
+
+	return storage, nil
+}
+
 func (self *StateObject) Storage() map[string]*ethutil.Value {
 	return self.storage
 }
@@ -118,7 +167,9 @@ func (self *StateObject) GetState(k []byte) *ethutil.Value {
 
 func (self *StateObject) SetState(k []byte, value *ethutil.Value) {
 	key := ethutil.LeftPadBytes(k, 32)
+	self.record(storageChange{object: self, key: string(key), prev: self.storage[string(key)]})
 	self.storage[string(key)] = value.Copy()
+	self.dirtyStorage[string(key)] = true
 }
 
 /*
@@ -141,8 +192,14 @@ func (self *StateObject) EachStorage(cb trie.EachCallback) {
 }
 */
 
+// Sync writes the storage slots set since the last Sync to the storage trie
 func (self *StateObject) Sync() {
-	for key, value := range self.storage {
+	for key := range self.dirtyStorage {
+		// A slot reverted to its uncached value is already in the trie
+		value, ok := self.storage[key]
+		if !ok {
+			continue
+		}
 		if value.Len() == 0 {
 			self.State.trie.Delete([]byte(key))
 			continue
@@ -150,6 +207,7 @@ func (self *StateObject) Sync() {
 
 		self.setAddr([]byte(key), value)
 	}
+	self.dirtyStorage = make(map[string]bool)
 
 	/*
 		valid, t2 := trie.ParanoiaCheck(self.State.trie, ethutil.Config.Db)
@@ -184,9 +242,15 @@ func (c *StateObject) SubBalance(amount *big.Int) {
 func (c *StateObject) SubAmount(amount *big.Int) { c.SubBalance(amount) }
 
 func (c *StateObject) SetBalance(amount *big.Int) {
+	c.record(balanceChange{object: c, prev: c.balance})
 	c.balance = amount
 }
 
+func (self *StateObject) SetNonce(nonce uint64) {
+	self.record(nonceChange{object: self, prev: self.Nonce})
+	self.Nonce = nonce
+}
+
 func (self *StateObject) Balance() *big.Int { return self.balance }
 
 //
@@ -231,11 +295,11 @@ func (self *StateObject) RefundGas(gas, price *big.Int) {
 	rGas := new(big.Int).Set(gas)
 	rGas.Mul(rGas, price)
 
-	self.balance.Sub(self.balance, rGas)
+	self.SetBalance(new(big.Int).Sub(self.balance, rGas))
 }
 
 func (self *StateObject) Copy() *StateObject {
-	stateObject := NewStateObject(self.Address(), self.db)
+	stateObject := newStateObject(self.Address(), self.db, self.secure)
 	stateObject.balance.Set(self.balance)
 	stateObject.codeHash = ethutil.CopyBytes(self.codeHash)
 	stateObject.Nonce = self.Nonce
@@ -245,8 +309,12 @@ func (self *StateObject) Copy() *StateObject {
 	stateObject.Code = ethutil.CopyBytes(self.Code)
 	stateObject.InitCode = ethutil.CopyBytes(self.InitCode)
 	stateObject.storage = self.storage.Copy()
+	for key := range self.dirtyStorage {
+		stateObject.dirtyStorage[key] = true
+	}
 	stateObject.gasPool.Set(self.gasPool)
 	stateObject.remove = self.remove
+	stateObject.dirty = self.dirty
 
 	return stateObject
 }
@@ -273,7 +341,7 @@ func (c *StateObject) Init() Code {
 	return c.InitCode
 }
 
-func (self *StateObject) Trie() *trie.Trie {
+func (self *StateObject) Trie() Trie {
 	return self.State.trie
 }
 
@@ -282,9 +350,19 @@ func (self *StateObject) Root() []byte {
 }
 
 func (self *StateObject) SetCode(code []byte) {
+	self.record(codeChange{object: self, prev: self.Code})
 	self.Code = code
 }
 
+// record marks the object dirty and adds entry to the journal of the state
+// holding it
+func (self *StateObject) record(entry journalEntry) {
+	self.dirty = true
+	if self.journal != nil {
+		*self.journal = append(*self.journal, entry)
+	}
+}
+
 //
 // Encoding
 //
@@ -303,8 +381,9 @@ func (c *StateObject) RlpDecode(data []byte) {
 
 	c.Nonce = decoder.Get(0).Uint()
 	c.balance = decoder.Get(1).BigInt()
-	c.State = New(decoder.Get(2).Bytes(), c.db) //New(trie.New(ethutil.Config.Db, decoder.Get(2).Interface()))
+	c.State = newState(decoder.Get(2).Bytes(), c.db, c.secure) //New(trie.New(ethutil.Config.Db, decoder.Get(2).Interface()))
 	c.storage = make(map[string]*ethutil.Value)
+	c.dirtyStorage = make(map[string]bool)
 	c.gasPool = new(big.Int)
 
 	c.codeHash = decoder.Get(3).Bytes()
@@ -1,10 +1,16 @@
 package state
 
 import (
+	"encoding/json"
+	"math/big"
+	"strings"
+
 	checker "gopkg.in/check.v1"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethutil"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 type StateSuite struct {
@@ -56,3 +62,276 @@ func (s *StateSuite) TestSnapshot(c *checker.C) {
 
 	c.Assert(data1, checker.DeepEquals, res)
 }
+
+func (s *StateSuite) TestJournalRevert(c *checker.C) {
+	addr := []byte("aa")
+	created := []byte("bb")
+	key := ethutil.Big("1")
+
+	stateObject := s.state.GetOrNewStateObject(addr)
+	stateObject.SetBalance(big.NewInt(10))
+	stateObject.SetNonce(1)
+	stateObject.SetCode([]byte{0x01})
+	stateObject.SetStorage(key, ethutil.NewValue(42))
+	s.state.Refund(addr, big.NewInt(5))
+
+	snapshot := s.state.Snapshot()
+
+	stateObject.AddBalance(big.NewInt(5))
+	stateObject.SetNonce(2)
+	stateObject.SetCode([]byte{0x02})
+	stateObject.SetStorage(key, ethutil.NewValue(43))
+	stateObject.SetStorage(ethutil.Big("2"), ethutil.NewValue(44))
+	stateObject.MarkForDeletion()
+	s.state.Refund(addr, big.NewInt(5))
+	s.state.Refund(created, big.NewInt(5))
+	s.state.AddLog(NewLog(addr, nil, nil))
+	s.state.NewStateObject(created).SetBalance(big.NewInt(1))
+
+	// A nested snapshot reverted first must not disturb the outer one
+	nested := s.state.Snapshot()
+	stateObject.SetNonce(3)
+	s.state.RevertToSnapshot(nested)
+	c.Assert(stateObject.Nonce, checker.Equals, uint64(2))
+
+	s.state.RevertToSnapshot(snapshot)
+
+	c.Assert(s.state.GetStateObject(addr), checker.Equals, stateObject)
+	c.Assert(stateObject.Balance().Int64(), checker.Equals, int64(10))
+	c.Assert(stateObject.Nonce, checker.Equals, uint64(1))
+	c.Assert(stateObject.Code, checker.DeepEquals, Code{0x01})
+	c.Assert(stateObject.GetStorage(key), checker.DeepEquals, ethutil.NewValue(42))
+	c.Assert(stateObject.GetStorage(ethutil.Big("2")).IsNil(), checker.Equals, true)
+	c.Assert(stateObject.remove, checker.Equals, false)
+	c.Assert(s.state.Refunds()[string(addr)].Int64(), checker.Equals, int64(5))
+	c.Assert(s.state.Refunds()[string(created)], checker.IsNil)
+	c.Assert(len(s.state.Logs()), checker.Equals, 0)
+	c.Assert(s.state.GetStateObject(created), checker.IsNil)
+}
+
+func (s *StateSuite) TestUpdateDirtyObjects(c *checker.C) {
+	written, read := []byte("aa"), []byte("bb")
+	key := ethutil.Big("1")
+
+	s.state.GetOrNewStateObject(written).SetStorage(key, ethutil.NewValue(42))
+	s.state.GetOrNewStateObject(read).SetBalance(big.NewInt(1))
+	s.state.Update(nil)
+	s.state.Sync()
+	root := s.state.Root()
+
+	// Reading objects and slots doesn't dirty them
+	statedb := New(root, s.state.db)
+	readObject := statedb.GetStateObject(read)
+	writtenObject := statedb.GetStateObject(written)
+	writtenObject.GetStorage(key)
+	c.Assert(readObject.dirty, checker.Equals, false)
+	c.Assert(writtenObject.dirty, checker.Equals, false)
+
+	writtenObject.SetStorage(ethutil.Big("2"), ethutil.NewValue(43))
+	c.Assert(writtenObject.dirty, checker.Equals, true)
+	c.Assert(len(writtenObject.dirtyStorage), checker.Equals, 1)
+
+	statedb.Update(nil)
+	c.Assert(writtenObject.dirty, checker.Equals, false)
+	c.Assert(len(writtenObject.dirtyStorage), checker.Equals, 0)
+	c.Assert(statedb.uncommitted, checker.DeepEquals, map[string]bool{string(ethutil.Address(written)): true})
+	statedb.Sync()
+
+	reloaded := New(statedb.Root(), s.state.db).GetStateObject(written)
+	c.Assert(reloaded.GetStorage(key).Uint(), checker.Equals, uint64(42))
+	c.Assert(reloaded.GetStorage(ethutil.Big("2")).Uint(), checker.Equals, uint64(43))
+}
+
+func (s *StateSuite) TestSyncCode(c *checker.C) {
+	addr, code := []byte("aa"), []byte{0x60, 0x01}
+
+	s.state.GetOrNewStateObject(addr).SetCode(code)
+	s.state.Update(nil)
+	hash := s.state.GetStateObject(addr).CodeHash()
+
+	// The code is written along with the tries, to the batch of the sync
+	data, _ := s.state.db.Get(hash)
+	c.Assert(len(data), checker.Equals, 0)
+
+	batch := s.state.db.NewBatch()
+	s.state.SyncTo(batch)
+	data, _ = s.state.db.Get(hash)
+	c.Assert(len(data), checker.Equals, 0)
+
+	c.Assert(batch.Write(), checker.IsNil)
+	c.Assert(New(s.state.Root(), s.state.db).GetCode(addr), checker.DeepEquals, code)
+}
+
+func (s *StateSuite) TestPrunerSweep(c *checker.C) {
+	addr := []byte("aa")
+	key := ethutil.Big("1")
+
+	db, _ := ethdb.NewMemDatabase()
+	pruner := NewPruner(db, 1, nil)
+
+	statedb := New(nil, pruner)
+	statedb.GetOrNewStateObject(addr).SetStorage(key, ethutil.NewValue(42))
+	statedb.Update(nil)
+	statedb.Sync()
+	rootA := statedb.Root()
+
+	pruner.SetHead(1)
+	statedb = New(rootA, pruner)
+	statedb.GetStateObject(addr).SetStorage(key, ethutil.NewValue(43))
+	statedb.Update(nil)
+	statedb.Sync()
+	rootB := statedb.Root()
+
+	// Nothing written by the retained block is swept
+	c.Assert(pruner.SetHead(2), checker.Equals, true)
+	c.Assert(pruner.Sweep([][]byte{rootB}) > 0, checker.Equals, true)
+
+	data, _ := db.Get(rootA)
+	c.Assert(len(data), checker.Equals, 0)
+	c.Assert(New(rootB, db).GetStateObject(addr).GetStorage(key).Uint(), checker.Equals, uint64(43))
+
+	c.Assert(pruner.Oldest(), checker.Equals, uint64(2))
+
+	// The pending candidates and the last sweep survive a restart
+	pending := len(pruner.candidates)
+	pruner.Save()
+	restarted := NewPruner(db, 1, nil)
+	c.Assert(len(restarted.candidates), checker.Equals, pending)
+	c.Assert(restarted.Oldest(), checker.Equals, uint64(2))
+
+	// They're kept until the next save, an exit without saving loses only
+	// the candidates written since the start
+	c.Assert(len(NewPruner(db, 1, nil).candidates), checker.Equals, pending)
+}
+
+func (s *StateSuite) TestProof(c *checker.C) {
+	addr := ethutil.Address([]byte("aa"))
+	key := ethutil.Big("1")
+
+	stateObject := s.state.GetOrNewStateObject(addr)
+	stateObject.SetBalance(big.NewInt(10))
+	stateObject.SetStorage(key, ethutil.NewValue(42))
+	s.state.Update(nil)
+	s.state.Sync()
+
+	account, err := trie.VerifyProof(s.state.Root(), addr, s.state.Prove(addr))
+	c.Assert(err, checker.IsNil)
+	c.Assert(account, checker.DeepEquals, stateObject.RlpEncode())
+
+	slot, err := trie.VerifyProof(stateObject.Root(), ethutil.LeftPadBytes(key.Bytes(), 32), stateObject.ProveStorage(key))
+	c.Assert(err, checker.IsNil)
+	c.Assert(ethutil.NewValueFromBytes(slot).Uint(), checker.Equals, uint64(42))
+
+	// Absent accounts and slots are proven too
+	absent := ethutil.Address([]byte("bb"))
+	account, err = trie.VerifyProof(s.state.Root(), absent, s.state.Prove(absent))
+	c.Assert(err, checker.IsNil)
+	c.Assert(account, checker.IsNil)
+
+	slot, err = trie.VerifyProof(stateObject.Root(), ethutil.LeftPadBytes([]byte{2}, 32), stateObject.ProveStorage(big.NewInt(2)))
+	c.Assert(err, checker.IsNil)
+	c.Assert(slot, checker.IsNil)
+}
+
+func (s *StateSuite) TestSecureState(c *checker.C) {
+	addr, removed := ethutil.Address([]byte("aa")), ethutil.Address([]byte("bb"))
+	key := ethutil.Big("1")
+
+	statedb := NewSecure(nil, s.state.db)
+	statedb.GetOrNewStateObject(addr).SetStorage(key, ethutil.NewValue(42))
+	statedb.GetOrNewStateObject(removed).SetBalance(big.NewInt(1))
+	statedb.Update(nil)
+	statedb.Sync()
+
+	statedb = NewSecure(statedb.Root(), s.state.db)
+	statedb.GetStateObject(removed).MarkForDeletion()
+	statedb.Update(nil)
+	statedb.Sync()
+	root := statedb.Root()
+
+	// The accounts and slots are keyed by their hash
+	c.Assert(New(root, s.state.db).GetStateObject(addr), checker.IsNil)
+	c.Assert(trie.New(root, s.state.db).Get(crypto.Sha3(addr)), checker.NotNil)
+
+	statedb = NewSecure(root, s.state.db)
+	c.Assert(statedb.GetStateObject(removed), checker.IsNil)
+	stateObject := statedb.GetStateObject(addr)
+	c.Assert(stateObject.GetStorage(key).Uint(), checker.Equals, uint64(42))
+	c.Assert(stateObject.Copy().GetStorage(key).Uint(), checker.Equals, uint64(42))
+
+	// Dumps hold the original keys
+	c.Assert(strings.Contains(string(statedb.Dump()), ethutil.Bytes2Hex(addr)), checker.Equals, true)
+	c.Assert(strings.Contains(string(statedb.Dump()), ethutil.Bytes2Hex(ethutil.LeftPadBytes(key.Bytes(), 32))), checker.Equals, true)
+}
+
+func (s *StateSuite) TestStorageRange(c *checker.C) {
+	stateObject := s.state.GetOrNewStateObject([]byte("aa"))
+	for i := int64(1); i <= 5; i++ {
+		stateObject.SetStorage(big.NewInt(i), ethutil.NewValue(i))
+	}
+	s.state.GetOrNewStateObject([]byte("bb")).SetBalance(big.NewInt(1))
+	s.state.Update(nil)
+	s.state.Sync()
+
+	stateObject = s.state.GetStateObject([]byte("aa"))
+	storage, next := stateObject.StorageRange(nil, 2)
+	c.Assert(len(storage), checker.Equals, 2)
+	c.Assert(storage[string(ethutil.LeftPadBytes([]byte{1}, 32))].Uint(), checker.Equals, uint64(1))
+	c.Assert(next, checker.DeepEquals, ethutil.LeftPadBytes([]byte{3}, 32))
+
+	storage, next = stateObject.StorageRange(next, 0)
+	c.Assert(len(storage), checker.Equals, 3)
+	c.Assert(storage[string(ethutil.LeftPadBytes([]byte{5}, 32))].Uint(), checker.Equals, uint64(5))
+	c.Assert(next, checker.IsNil)
+
+	var world World
+	c.Assert(json.Unmarshal(s.state.DumpRange(nil, 1), &world), checker.IsNil)
+	c.Assert(len(world.Accounts), checker.Equals, 1)
+	c.Assert(world.Next, checker.Equals, ethutil.Bytes2Hex(ethutil.Address([]byte("bb"))))
+
+	var rest World
+	c.Assert(json.Unmarshal(s.state.DumpRange(ethutil.Hex2Bytes(world.Next), 1), &rest), checker.IsNil)
+	c.Assert(rest.Next, checker.Equals, "")
+	c.Assert(rest.Accounts[world.Next].Balance, checker.Equals, "1")
+}
+
+func (s *StateSuite) TestDiff(c *checker.C) {
+	changed, removed, created := ethutil.Address([]byte("aa")), ethutil.Address([]byte("bb")), ethutil.Address([]byte("cc"))
+	unchanged := ethutil.Address([]byte("dd"))
+	key := ethutil.Big("1")
+
+	s.state.GetOrNewStateObject(changed).SetStorage(key, ethutil.NewValue(1))
+	s.state.GetOrNewStateObject(removed).SetBalance(big.NewInt(5))
+	s.state.GetOrNewStateObject(unchanged).SetBalance(big.NewInt(7))
+	s.state.Update(nil)
+	s.state.Sync()
+	from := New(s.state.Root(), s.state.db)
+
+	statedb := New(from.Root(), s.state.db)
+	object := statedb.GetStateObject(changed)
+	object.SetStorage(key, ethutil.NewValue(2))
+	object.SetNonce(3)
+	statedb.GetStateObject(removed).MarkForDeletion()
+	statedb.GetOrNewStateObject(created).SetCode([]byte{0x60, 0x01})
+	statedb.Update(nil)
+	statedb.Sync()
+	to := New(statedb.Root(), s.state.db)
+
+	diffs := Diff(from, to)
+	c.Assert(len(diffs), checker.Equals, 3)
+
+	c.Assert(diffs[0].Address, checker.DeepEquals, changed)
+	c.Assert(diffs[0].OldNonce, checker.Equals, uint64(0))
+	c.Assert(diffs[0].NewNonce, checker.Equals, uint64(3))
+	c.Assert(diffs[0].Storage, checker.DeepEquals, []*StorageDiff{{Key: ethutil.LeftPadBytes(key.Bytes(), 32), Old: []byte{1}, New: []byte{2}}})
+
+	c.Assert(diffs[1].Address, checker.DeepEquals, removed)
+	c.Assert(diffs[1].OldBalance.Int64(), checker.Equals, int64(5))
+	c.Assert(diffs[1].NewBalance.Int64(), checker.Equals, int64(0))
+
+	c.Assert(diffs[2].Address, checker.DeepEquals, created)
+	c.Assert(diffs[2].OldCodeHash, checker.IsNil)
+	c.Assert(diffs[2].NewCodeHash, checker.DeepEquals, crypto.Sha3([]byte{0x60, 0x01}))
+
+	c.Assert(len(Diff(from, from)), checker.Equals, 0)
+}
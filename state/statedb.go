@@ -2,6 +2,7 @@ package state
 
 import (
 	"bytes"
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/ethutil"
@@ -16,23 +17,87 @@ var statelogger = logger.NewLogger("STATE")
 // nested states. It's the general query interface to retrieve:
 // * Contracts
 // * Accounts
+// Trie is the trie holding the accounts of a state or the storage of an
+// account, a plain trie.Trie or a trie.SecureTrie
+type Trie interface {
+	Get(key []byte) []byte
+	Update(key, value []byte) trie.Node
+	Delete(key []byte) trie.Node
+	Root() []byte
+	Reset()
+	Commit()
+	CommitTo(db trie.Writer)
+	Iterator() *trie.Iterator
+	GetKey(key []byte) []byte
+	Prove(key []byte) [][]byte
+}
+
 type StateDB struct {
 	db   ethutil.Database
-	trie *trie.Trie
+	trie Trie
+	// Whether the account and storage tries are secure tries
+	secure bool
 
 	stateObjects map[string]*StateObject
+	// Objects written to the trie since the last Sync, their storage tries
+	// are committed on Sync
+	uncommitted map[string]bool
+	// Code of the objects written to the trie since the last Sync by hash,
+	// written to the database on Sync
+	code map[string][]byte
 
 	manifest *Manifest
 
 	refund map[string]*big.Int
 
 	logs Logs
+
+	journal journal
 }
 
 // Create a new state from a given trie
 func New(root []byte, db ethutil.Database) *StateDB {
-	trie := trie.New(root, db)
-	return &StateDB{db: db, trie: trie, stateObjects: make(map[string]*StateObject), manifest: NewManifest(), refund: make(map[string]*big.Int)}
+	return newState(root, db, false)
+}
+
+// NewSecure creates a new state whose account and storage tries hash their
+// keys, see trie.SecureTrie. A state root can only be opened in the mode it
+// was written in.
+func NewSecure(root []byte, db ethutil.Database) *StateDB {
+	return newState(root, db, true)
+}
+
+func newState(root []byte, db ethutil.Database, secure bool) *StateDB {
+	var tr Trie
+	if secure {
+		tr = trie.NewSecure(root, db)
+	} else {
+		tr = trie.New(root, db)
+	}
+
+	return &StateDB{db: db, trie: tr, secure: secure, stateObjects: make(map[string]*StateObject), uncommitted: make(map[string]bool), code: make(map[string][]byte), manifest: NewManifest(), refund: make(map[string]*big.Int)}
+}
+
+// copyTrie returns a copy of the committed state of t
+func copyTrie(t Trie) Trie {
+	switch t := t.(type) {
+	case *trie.SecureTrie:
+		return t.Copy()
+	case *trie.Trie:
+		return t.Copy()
+	}
+
+	panic(fmt.Sprintf("cannot copy trie of type %T", t))
+}
+
+// plainTrie returns the trie holding the nodes of t, the keys of a secure
+// trie are hashed in it
+func plainTrie(t Trie) *trie.Trie {
+	if secure, ok := t.(*trie.SecureTrie); ok {
+		return secure.Trie
+	}
+
+	return t.(*trie.Trie)
 }
 
 func (self *StateDB) EmptyLogs() {
@@ -40,6 +105,7 @@ func (self *StateDB) EmptyLogs() {
 }
 
 func (self *StateDB) AddLog(log Log) {
+	self.journal = append(self.journal, addLogChange{prevLen: len(self.logs)})
 	self.logs = append(self.logs, log)
 }
 
@@ -58,10 +124,13 @@ func (self *StateDB) GetBalance(addr []byte) *big.Int {
 }
 
 func (self *StateDB) Refund(addr []byte, gas *big.Int) {
-	if self.refund[string(addr)] == nil {
-		self.refund[string(addr)] = new(big.Int)
+	prev := self.refund[string(addr)]
+	self.journal = append(self.journal, refundChange{addr: string(addr), prev: prev})
+
+	if prev == nil {
+		prev = new(big.Int)
 	}
-	self.refund[string(addr)].Add(self.refund[string(addr)], gas)
+	self.refund[string(addr)] = new(big.Int).Add(prev, gas)
 }
 
 func (self *StateDB) AddBalance(addr []byte, amount *big.Int) {
@@ -83,7 +152,7 @@ func (self *StateDB) GetNonce(addr []byte) uint64 {
 func (self *StateDB) SetNonce(addr []byte, nonce uint64) {
 	stateObject := self.GetStateObject(addr)
 	if stateObject != nil {
-		stateObject.Nonce = nonce
+		stateObject.SetNonce(nonce)
 	}
 }
 
@@ -139,10 +208,11 @@ func (self *StateDB) UpdateStateObject(stateObject *StateObject) {
 	addr := stateObject.Address()
 
 	if len(stateObject.CodeHash()) > 0 {
-		self.db.Put(stateObject.CodeHash(), stateObject.Code)
+		self.code[string(stateObject.CodeHash())] = stateObject.Code
 	}
 
 	self.trie.Update(addr, stateObject.RlpEncode())
+	self.uncommitted[string(addr)] = true
 }
 
 // Delete the given state object and delete it from the state trie
@@ -166,14 +236,20 @@ func (self *StateDB) GetStateObject(addr []byte) *StateObject {
 		return nil
 	}
 
-	stateObject = NewStateObjectFromBytes(addr, []byte(data), self.db)
-	self.SetStateObject(stateObject)
+	// Loading an object from the trie isn't a change, it's not journaled
+	stateObject = newStateObjectFromBytes(addr, []byte(data), self.db, self.secure)
+	stateObject.journal = &self.journal
+	self.stateObjects[string(addr)] = stateObject
 
 	return stateObject
 }
 
 func (self *StateDB) SetStateObject(object *StateObject) {
-	self.stateObjects[string(object.address)] = object
+	addr := string(object.address)
+	self.journal = append(self.journal, createObjectChange{addr: addr, prev: self.stateObjects[addr]})
+
+	object.journal = &self.journal
+	self.stateObjects[addr] = object
 }
 
 // Retrieve a state object or create a new state object if nil
@@ -192,8 +268,8 @@ func (self *StateDB) NewStateObject(addr []byte) *StateObject {
 
 	statelogger.Debugf("(+) %x\n", addr)
 
-	stateObject := NewStateObject(addr, self.db)
-	self.stateObjects[string(addr)] = stateObject
+	stateObject := newStateObject(addr, self.db, self.secure)
+	self.SetStateObject(stateObject)
 
 	return stateObject
 }
@@ -213,10 +289,17 @@ func (s *StateDB) Cmp(other *StateDB) bool {
 
 func (self *StateDB) Copy() *StateDB {
 	if self.trie != nil {
-		state := New(nil, self.db)
-		state.trie = self.trie.Copy()
+		state := newState(nil, self.db, self.secure)
+		state.trie = copyTrie(self.trie)
 		for k, stateObject := range self.stateObjects {
 			state.stateObjects[k] = stateObject.Copy()
+			state.stateObjects[k].journal = &state.journal
+		}
+		for addr := range self.uncommitted {
+			state.uncommitted[addr] = true
+		}
+		for hash, code := range self.code {
+			state.code[hash] = code
 		}
 
 		for addr, refund := range self.refund {
@@ -239,15 +322,49 @@ func (self *StateDB) Set(state *StateDB) {
 	}
 
 	self.trie = state.trie
+	self.secure = state.secure
 	self.stateObjects = state.stateObjects
+	self.uncommitted = state.uncommitted
+	self.code = state.code
 	self.refund = state.refund
 	self.logs = state.logs
+
+	// The objects now belong to this state, snapshots taken before are invalid
+	self.journal = nil
+	for _, stateObject := range self.stateObjects {
+		stateObject.journal = &self.journal
+	}
+}
+
+// Snapshot returns an identifier for the current revision of the state. The
+// identifier is valid until the state is updated, synced or reset.
+func (self *StateDB) Snapshot() int {
+	return len(self.journal)
+}
+
+// RevertToSnapshot undoes all changes made since the snapshot with the given
+// identifier was taken
+func (self *StateDB) RevertToSnapshot(id int) {
+	if id < 0 || id > len(self.journal) {
+		panic(fmt.Sprintf("invalid state snapshot %d, journal holds %d changes", id, len(self.journal)))
+	}
+
+	for i := len(self.journal) - 1; i >= id; i-- {
+		self.journal[i].undo(self)
+	}
+	self.journal = self.journal[:id]
 }
 
 func (s *StateDB) Root() []byte {
 	return s.trie.Root()
 }
 
+// Prove returns a merkle proof of the account at addr, or of its absence,
+// against Root. Changes not yet written by Update aren't part of it.
+func (self *StateDB) Prove(addr []byte) [][]byte {
+	return self.trie.Prove(ethutil.Address(addr))
+}
+
 // Resets the trie and all siblings
 func (s *StateDB) Reset() {
 	s.trie.Reset()
@@ -264,25 +381,45 @@ func (s *StateDB) Reset() {
 	s.Empty()
 }
 
-// Syncs the trie and all siblings
+// Syncs the trie, the storage tries and the code of the objects written to it,
+// in a single batch of the database
 func (s *StateDB) Sync() {
-	// Sync all nested states
-	for _, stateObject := range s.stateObjects {
-		if stateObject.State == nil {
+	batch := s.db.NewBatch()
+	s.SyncTo(batch)
+	if err := batch.Write(); err != nil {
+		statelogger.Errorln("sync failed:", err)
+	}
+}
+
+// SyncTo writes the trie, the storage tries and the code of the objects
+// written to it to db instead of the database, such as a batch along with the
+// block of the state
+func (s *StateDB) SyncTo(db trie.Writer) {
+	for hash, code := range s.code {
+		db.Put([]byte(hash), code)
+	}
+
+	// Sync the nested states of updated objects
+	for addr := range s.uncommitted {
+		stateObject := s.stateObjects[addr]
+		if stateObject == nil || stateObject.State == nil {
 			continue
 		}
 
-		stateObject.State.Sync()
+		stateObject.State.SyncTo(db)
 	}
 
-	s.trie.Commit()
+	s.trie.CommitTo(db)
 
 	s.Empty()
 }
 
 func (self *StateDB) Empty() {
 	self.stateObjects = make(map[string]*StateObject)
+	self.uncommitted = make(map[string]bool)
+	self.code = make(map[string][]byte)
 	self.refund = make(map[string]*big.Int)
+	self.journal = nil
 }
 
 func (self *StateDB) Refunds() map[string]*big.Int {
@@ -293,8 +430,15 @@ func (self *StateDB) Update(gasUsed *big.Int) {
 	var deleted bool
 
 	self.refund = make(map[string]*big.Int)
+	self.journal = nil
 
+	// Objects that were only read are left alone
 	for _, stateObject := range self.stateObjects {
+		if !stateObject.dirty {
+			continue
+		}
+		stateObject.dirty = false
+
 		if stateObject.remove {
 			self.DeleteStateObject(stateObject)
 			deleted = true
@@ -307,11 +451,16 @@ func (self *StateDB) Update(gasUsed *big.Int) {
 
 	// FIXME trie delete is broken
 	if deleted {
-		valid, t2 := trie.ParanoiaCheck(self.trie, self.db)
+		// A secure trie is rebuilt from its hashed keys as they are
+		valid, t2 := trie.ParanoiaCheck(plainTrie(self.trie), self.db)
 		if !valid {
 			statelogger.Infof("Warn: PARANOIA: Different state root during copy %x vs %x\n", self.trie.Root(), t2.Root())
 
-			self.trie = t2
+			if secure, ok := self.trie.(*trie.SecureTrie); ok {
+				secure.Trie = t2
+			} else {
+				self.trie = t2
+			}
 		}
 	}
 }
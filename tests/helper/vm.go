@@ -13,6 +13,7 @@ import (
 
 type Env struct {
 	depth        int
+	frameDepth   int
 	state        *state.StateDB
 	skipTransfer bool
 	initial      bool
@@ -28,11 +29,16 @@ type Env struct {
 	gasLimit   *big.Int
 
 	logs state.Logs
+
+	gasTable  *vm.GasTable
+	jumpTable *vm.JumpTable
 }
 
 func NewEnv(state *state.StateDB) *Env {
 	return &Env{
-		state: state,
+		state:     state,
+		gasTable:  vm.DefaultGasTable(),
+		jumpTable: vm.DefaultJumpTable(),
 	}
 }
 
@@ -65,8 +71,14 @@ func (self *Env) GetHash(n uint64) []byte {
 func (self *Env) AddLog(log state.Log) {
 	self.logs = append(self.logs, log)
 }
-func (self *Env) Depth() int     { return self.depth }
-func (self *Env) SetDepth(i int) { self.depth = i }
+func (self *Env) Depth() int          { return self.depth }
+func (self *Env) SetDepth(i int)      { self.depth = i }
+func (self *Env) FrameDepth() int     { return self.frameDepth }
+func (self *Env) SetFrameDepth(i int) { self.frameDepth = i }
+
+func (self *Env) GasTable() *vm.GasTable   { return self.gasTable }
+func (self *Env) JumpTable() *vm.JumpTable { return self.jumpTable }
+func (self *Env) Tracer() vm.Tracer        { return nil }
 func (self *Env) Transfer(from, to vm.Account, amount *big.Int) error {
 	if self.skipTransfer {
 		// ugly hack
@@ -99,7 +111,7 @@ func (self *Env) Call(caller vm.ContextRef, addr, data []byte, gas, price, value
 }
 func (self *Env) CallCode(caller vm.ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error) {
 	exe := self.vm(caller.Address(), data, gas, price, value)
-	return exe.Call(addr, caller)
+	return exe.CallCode(addr, caller)
 }
 
 func (self *Env) Create(caller vm.ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error, vm.ContextRef) {
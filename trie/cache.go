@@ -1,23 +1,72 @@
 package trie
 
+import "github.com/ethereum/go-ethereum/ethutil"
+
 type Backend interface {
 	Get([]byte) ([]byte, error)
 	Put([]byte, []byte)
 }
 
+// Writer is written the nodes of a commit, a Backend or a batch of one
+type Writer interface {
+	Put([]byte, []byte)
+}
+
+// CachedBackend is implemented by backends whose tries share a node cache,
+// see CachedDatabase. A nil cache disables caching.
+type CachedBackend interface {
+	Backend
+	NodeCache() *NodeCache
+}
+
+// batcher is implemented by backends which can write a set of keys atomically
+type batcher interface {
+	NewBatch() ethutil.Batch
+}
+
+// withBatch calls write with a batch of backend and writes the batch, or with
+// the backend itself if it can't batch writes
+func withBatch(backend Backend, write func(Writer)) {
+	if db, ok := backend.(batcher); ok {
+		batch := db.NewBatch()
+		write(batch)
+		batch.Write()
+	} else {
+		write(backend)
+	}
+}
+
+// Cache holds the nodes of a trie written since its last commit and reads
+// the other nodes through the node cache of the backend, if it has one, see
+// CachedBackend
 type Cache struct {
 	store   map[string][]byte
 	backend Backend
+	nodes   *NodeCache
 }
 
 func NewCache(backend Backend) *Cache {
-	return &Cache{make(map[string][]byte), backend}
+	cache := &Cache{store: make(map[string][]byte), backend: backend}
+	if cached, ok := backend.(CachedBackend); ok {
+		cache.nodes = cached.NodeCache()
+	}
+
+	return cache
 }
 
 func (self *Cache) Get(key []byte) []byte {
-	data := self.store[string(key)]
-	if data == nil {
-		data, _ = self.backend.Get(key)
+	if data := self.store[string(key)]; data != nil {
+		return data
+	}
+
+	if self.nodes != nil {
+		if data, ok := self.nodes.Get(key); ok {
+			return data
+		}
+	}
+	data, _ := self.backend.Get(key)
+	if self.nodes != nil && len(data) > 0 {
+		self.nodes.Put(key, data)
 	}
 
 	return data
@@ -27,14 +76,23 @@ func (self *Cache) Put(key []byte, data []byte) {
 	self.store[string(key)] = data
 }
 
+// Flush writes the stored nodes to the backend, in a single batch if the
+// backend supports batches
 func (self *Cache) Flush() {
+	withBatch(self.backend, self.FlushTo)
+}
+
+// FlushTo writes the stored nodes to db instead of the backend. They're moved
+// to the node cache, later reads of them go through the backend.
+func (self *Cache) FlushTo(db Writer) {
 	for k, v := range self.store {
-		self.backend.Put([]byte(k), v)
+		db.Put([]byte(k), v)
+		if self.nodes != nil {
+			self.nodes.Put([]byte(k), v)
+		}
 	}
 
-	// This will eventually grow too large. We'd could
-	// do a make limit on storage and push out not-so-popular nodes.
-	//self.Reset()
+	self.Reset()
 }
 
 func (self *Cache) Reset() {
@@ -0,0 +1,85 @@
+package trie
+
+import "bytes"
+
+// DiffIterator walks two tries at once and visits the keys whose values
+// differ between them. Subtrees with the same hash in both tries are skipped
+// without being loaded. The tries should be hashed, see NodeIterator.
+type DiffIterator struct {
+	a, b     *NodeIterator
+	aok, bok bool // whether a and b are at a node
+
+	Key []byte
+	// Values of Key in the first and the second trie, nil if it's absent
+	Old []byte
+	New []byte
+}
+
+func NewDiffIterator(a, b *Trie) *DiffIterator {
+	it := &DiffIterator{a: a.NodeIterator(), b: b.NodeIterator()}
+	it.aok, it.bok = it.a.Next(), it.b.Next()
+
+	return it
+}
+
+// Next moves to the next key whose value differs and reports whether there
+// is one
+func (self *DiffIterator) Next() bool {
+	for self.aok || self.bok {
+		switch cmp := self.compare(); {
+		case cmp < 0:
+			// The node is only in the first trie
+			leaf, key, value := self.a.Leaf, self.a.Key, self.a.Value
+			self.aok = self.a.Next()
+			if leaf {
+				self.Key, self.Old, self.New = key, value, nil
+				return true
+			}
+		case cmp > 0:
+			leaf, key, value := self.b.Leaf, self.b.Key, self.b.Value
+			self.bok = self.b.Next()
+			if leaf {
+				self.Key, self.Old, self.New = key, nil, value
+				return true
+			}
+		default:
+			if self.a.Hash != nil && bytes.Equal(self.a.Hash, self.b.Hash) {
+				self.a.Skip()
+				self.b.Skip()
+			}
+
+			leaf, key, old, value := self.a.Leaf, self.a.Key, self.a.Value, self.b.Value
+			self.aok, self.bok = self.a.Next(), self.b.Next()
+			if leaf && !bytes.Equal(old, value) {
+				self.Key, self.Old, self.New = key, old, value
+				return true
+			}
+		}
+	}
+	self.Key, self.Old, self.New = nil, nil, nil
+
+	return false
+}
+
+// compare orders the current nodes of both tries by path, a node comes before
+// the value at its own path
+func (self *DiffIterator) compare() int {
+	switch {
+	case !self.aok:
+		return 1
+	case !self.bok:
+		return -1
+	}
+
+	if cmp := bytes.Compare(self.a.Path, self.b.Path); cmp != 0 {
+		return cmp
+	}
+	switch {
+	case self.a.Leaf == self.b.Leaf:
+		return 0
+	case self.a.Leaf:
+		return 1
+	}
+
+	return -1
+}
@@ -1,111 +1,46 @@
 package trie
 
-import "bytes"
-
+// Iterator iterates over the keys and values of a trie in key order. It can
+// be limited to a range of keys with Seek and SetEnd or to the keys with a
+// given prefix with SetPrefix, see NodeIterator.
 type Iterator struct {
-	trie *Trie
+	nodes *NodeIterator
 
 	Key   []byte
 	Value []byte
 }
 
 func NewIterator(trie *Trie) *Iterator {
-	return &Iterator{trie: trie, Key: make([]byte, 32)}
+	return &Iterator{nodes: NewNodeIterator(trie)}
 }
 
-func (self *Iterator) Next() bool {
-	self.trie.mu.Lock()
-	defer self.trie.mu.Unlock()
-
-	key := RemTerm(CompactHexDecode(string(self.Key)))
-	k := self.next(self.trie.root, key)
-
-	self.Key = []byte(DecodeCompact(k))
-
-	return len(k) > 0
+// PrefixIterator returns an iterator over the keys starting with prefix
+func (self *Trie) PrefixIterator(prefix []byte) *Iterator {
+	it := NewIterator(self)
+	it.SetPrefix(prefix)
 
+	return it
 }
 
-func (self *Iterator) next(node Node, key []byte) []byte {
-	if node == nil {
-		return nil
-	}
-
-	switch node := node.(type) {
-	case *FullNode:
-		if len(key) > 0 {
-			k := self.next(node.branch(key[0]), key[1:])
-			if k != nil {
-				return append([]byte{key[0]}, k...)
-			}
-		}
-
-		var r byte
-		if len(key) > 0 {
-			r = key[0] + 1
-		}
-
-		for i := r; i < 16; i++ {
-			k := self.key(node.branch(byte(i)))
-			if k != nil {
-				return append([]byte{i}, k...)
-			}
-		}
+// Seek restarts the iteration at the first key at or after key
+func (self *Iterator) Seek(key []byte) { self.nodes.Seek(key) }
 
-	case *ShortNode:
-		k := RemTerm(node.Key())
-		if vnode, ok := node.Value().(*ValueNode); ok {
-			if bytes.Compare([]byte(k), key) > 0 {
-				self.Value = vnode.Val()
-				return k
-			}
-		} else {
-			cnode := node.Value()
+// SetEnd stops the iteration before the first key at or after key, a nil key
+// removes the end
+func (self *Iterator) SetEnd(key []byte) { self.nodes.SetEnd(key) }
 
-			var ret []byte
-			skey := key[len(k):]
-			if BeginsWith(key, k) {
-				ret = self.next(cnode, skey)
-			} else if bytes.Compare(k, key[:len(k)]) > 0 {
-				ret = self.key(node)
-			}
+// SetPrefix restarts the iteration limited to the keys starting with prefix
+func (self *Iterator) SetPrefix(prefix []byte) { self.nodes.SetPrefix(prefix) }
 
-			if ret != nil {
-				return append(k, ret...)
-			}
-		}
-	}
-
-	return nil
-}
-
-func (self *Iterator) key(node Node) []byte {
-	switch node := node.(type) {
-	case *ShortNode:
-		// Leaf node
-		if vnode, ok := node.Value().(*ValueNode); ok {
-			k := RemTerm(node.Key())
-			self.Value = vnode.Val()
-
-			return k
-		} else {
-			k := RemTerm(node.Key())
-			return append(k, self.key(node.Value())...)
-		}
-	case *FullNode:
-		if node.Value() != nil {
-			self.Value = node.Value().(*ValueNode).Val()
-
-			return []byte{16}
-		}
-
-		for i := 0; i < 16; i++ {
-			k := self.key(node.branch(byte(i)))
-			if k != nil {
-				return append([]byte{byte(i)}, k...)
-			}
+// Next moves to the next key and reports whether there is one
+func (self *Iterator) Next() bool {
+	for self.nodes.Next() {
+		if self.nodes.Leaf {
+			self.Key, self.Value = self.nodes.Key, self.nodes.Value
+			return true
 		}
 	}
+	self.Key, self.Value = nil, nil
 
-	return nil
+	return false
 }
@@ -1,6 +1,11 @@
 package trie
 
-import "testing"
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
 
 func TestIterator(t *testing.T) {
 	trie := NewEmpty()
@@ -31,3 +36,129 @@ func TestIterator(t *testing.T) {
 		}
 	}
 }
+
+func iteratorTestTrie() *Trie {
+	trie := NewEmpty()
+	for _, k := range []string{"do", "dog", "doge", "dogglesworth", "ether", "horse", "shaman", "somethingveryoddindeedthis is"} {
+		trie.UpdateString(k, "value of "+k)
+	}
+	trie.Commit()
+
+	return New(trie.Root(), trie.cache.backend)
+}
+
+func iteratorKeys(it *Iterator) (keys []string) {
+	for it.Next() {
+		if string(it.Value) != "value of "+string(it.Key) {
+			keys = append(keys, "bad value "+string(it.Value))
+		}
+		keys = append(keys, string(it.Key))
+	}
+
+	return
+}
+
+func TestIteratorRange(t *testing.T) {
+	trie := iteratorTestTrie()
+
+	tests := []struct {
+		start, end string
+		prefix     bool
+		exp        string
+	}{
+		{"", "", false, "do dog doge dogglesworth ether horse shaman somethingveryoddindeedthis is"},
+		{"dog", "", false, "dog doge dogglesworth ether horse shaman somethingveryoddindeedthis is"},
+		{"dogf", "", false, "dogglesworth ether horse shaman somethingveryoddindeedthis is"},
+		{"e", "s", false, "ether horse"},
+		{"", "doge", false, "do dog"},
+		{"z", "", false, ""},
+		{"dog", "", true, "dog doge dogglesworth"},
+		{"s", "", true, "shaman somethingveryoddindeedthis is"},
+		{"x", "", true, ""},
+	}
+	for _, test := range tests {
+		it := trie.Iterator()
+		if test.prefix {
+			it.SetPrefix([]byte(test.start))
+		} else {
+			it.Seek([]byte(test.start))
+			if test.end != "" {
+				it.SetEnd([]byte(test.end))
+			}
+		}
+		if keys := strings.Join(iteratorKeys(it), " "); keys != test.exp {
+			t.Errorf("start %q end %q prefix %v: expected %q got %q", test.start, test.end, test.prefix, test.exp, keys)
+		}
+	}
+
+	if keys := strings.Join(iteratorKeys(trie.PrefixIterator([]byte("ho"))), " "); keys != "horse" {
+		t.Errorf("prefix iterator: expected %q got %q", "horse", keys)
+	}
+}
+
+func TestNodeIterator(t *testing.T) {
+	trie := iteratorTestTrie()
+	db := trie.cache.backend.(Db)
+
+	hashes := make(map[string]bool)
+	it := trie.NodeIterator()
+	for it.Next() {
+		if it.Hash != nil {
+			if _, ok := db[string(it.Hash)]; !ok {
+				t.Errorf("node %x at %x not in database", it.Hash, it.Path)
+			}
+			hashes[string(it.Hash)] = true
+		}
+		if it.Leaf && !bytes.Equal(it.Path, RemTerm(CompactHexDecode(string(it.Key)))) {
+			t.Errorf("leaf %q has path %x", it.Key, it.Path)
+		}
+	}
+	if len(hashes) != len(db) {
+		t.Errorf("expected %d stored nodes, visited %d", len(db), len(hashes))
+	}
+}
+
+type countingDb struct {
+	Db
+	gets int
+}
+
+func (self *countingDb) Get(k []byte) ([]byte, error) {
+	self.gets++
+	return self.Db.Get(k)
+}
+
+func TestDiffIterator(t *testing.T) {
+	db := &countingDb{Db: make(Db)}
+	a := New(nil, db)
+	for i := 0; i < 200; i++ {
+		a.UpdateString(fmt.Sprintf("key%03d", i), fmt.Sprintf("value%d", i))
+	}
+	a.Commit()
+
+	b := New(a.Root(), db)
+	b.UpdateString("key007", "changed")
+	b.DeleteString("key100")
+	b.UpdateString("key999", "added")
+	b.Commit()
+
+	a, b = New(a.Root(), db), New(b.Root(), db)
+	db.gets = 0
+
+	var diffs []string
+	it := NewDiffIterator(a, b)
+	for it.Next() {
+		diffs = append(diffs, fmt.Sprintf("%s:%s>%s", it.Key, it.Old, it.New))
+	}
+	exp := "key007:value7>changed key100:value100> key999:>added"
+	if got := strings.Join(diffs, " "); got != exp {
+		t.Errorf("expected %q got %q", exp, got)
+	}
+	if db.gets >= len(db.Db) {
+		t.Errorf("expected unchanged subtrees to be skipped, loaded %d of %d nodes", db.gets, len(db.Db))
+	}
+
+	if NewDiffIterator(a, New(a.Root(), db)).Next() {
+		t.Error("expected no differences between equal tries")
+	}
+}
@@ -0,0 +1,134 @@
+package trie
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/ethutil"
+)
+
+// cacheEntryOverhead approximates the memory taken by the bookkeeping of a
+// cached node, its list element, entry and map slot, on top of its key and
+// data
+const cacheEntryOverhead = 128
+
+// NodeCache is a least recently used cache of the encoded nodes read from and
+// committed to a database. Its size is the total length of the cached keys
+// and nodes plus a fixed overhead per node, the least recently used nodes are
+// evicted to keep it within the limit. Nodes are stored by their hash so a
+// cached node is never stale, even if it has been deleted from the database.
+type NodeCache struct {
+	mu    sync.Mutex
+	limit int
+	size  int
+	lru   *list.List // most recently used at the front
+	nodes map[string]*list.Element
+
+	hits, misses uint64
+}
+
+type cacheEntry struct {
+	key  string
+	data []byte
+}
+
+// NewNodeCache creates a cache holding at most limit bytes of nodes
+func NewNodeCache(limit int) *NodeCache {
+	return &NodeCache{limit: limit, lru: list.New(), nodes: make(map[string]*list.Element)}
+}
+
+// Get returns the node with the given hash and whether it's cached
+func (self *NodeCache) Get(key []byte) ([]byte, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	elem, ok := self.nodes[string(key)]
+	if !ok {
+		self.misses++
+		return nil, false
+	}
+	self.hits++
+	self.lru.MoveToFront(elem)
+
+	return elem.Value.(*cacheEntry).data, true
+}
+
+// Put caches the node and evicts the least recently used nodes over the limit
+func (self *NodeCache) Put(key, data []byte) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if elem, ok := self.nodes[string(key)]; ok {
+		self.lru.MoveToFront(elem)
+		return
+	}
+	// Nodes larger than the whole cache aren't kept
+	if entrySize(key, data) > self.limit {
+		return
+	}
+
+	self.nodes[string(key)] = self.lru.PushFront(&cacheEntry{string(key), data})
+	self.size += entrySize(key, data)
+
+	for self.size > self.limit {
+		entry := self.lru.Remove(self.lru.Back()).(*cacheEntry)
+		delete(self.nodes, entry.key)
+		self.size -= entrySize([]byte(entry.key), entry.data)
+	}
+}
+
+// entrySize returns the number of bytes a cached node is accounted for
+func entrySize(key, data []byte) int {
+	return len(key) + len(data) + cacheEntryOverhead
+}
+
+// Len returns the number of cached nodes
+func (self *NodeCache) Len() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return len(self.nodes)
+}
+
+// Size returns the number of bytes held by the cache, including the overhead
+// of the entries
+func (self *NodeCache) Size() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.size
+}
+
+// Hits returns the number of lookups which found their node
+func (self *NodeCache) Hits() uint64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.hits
+}
+
+// Misses returns the number of lookups which had to read the database
+func (self *NodeCache) Misses() uint64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.misses
+}
+
+// CachedDatabase is a database whose tries share a node cache
+type CachedDatabase struct {
+	ethutil.Database
+	cache *NodeCache
+}
+
+// NewCachedDatabase returns db with the tries opened on it sharing cache.
+// Other backends writing to db, such as a pruner, should share the same
+// cache, see CachedBackend.
+func NewCachedDatabase(db ethutil.Database, cache *NodeCache) *CachedDatabase {
+	return &CachedDatabase{db, cache}
+}
+
+// NodeCache returns the cache shared by the tries of the database
+func (self *CachedDatabase) NodeCache() *NodeCache {
+	return self.cache
+}
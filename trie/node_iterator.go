@@ -0,0 +1,211 @@
+package trie
+
+import "bytes"
+
+// NodeIterator walks the nodes of a trie depth first, parents before their
+// children and children in key order. Every node is visited with its path,
+// the nibbles leading to it from the root, and its hash if it's stored by
+// hash. Values are visited as leaves, their path is the key of the value.
+//
+// The visited nodes can be limited to the range of paths from start up to but
+// excluding end with Seek and SetEnd, or to the paths with a given prefix with
+// SetPrefix. Ranges are over the keys held by the trie, which for a SecureTrie
+// are the hashed keys.
+type NodeIterator struct {
+	trie *Trie
+
+	stack   []*nodeFrame
+	started bool
+	start   []byte // nibbles of the first path visited
+	end     []byte // nibbles of the path iteration stops at, nil for no end
+
+	Node Node
+	// Hash of the node, nil for nodes embedded in their parent or not yet
+	// hashed. The hash of the root is the hash of the last Hash or Commit.
+	Hash []byte
+	Path []byte
+	// Leaf is set for values, Key and Value hold the key and the value
+	Leaf  bool
+	Key   []byte
+	Value []byte
+}
+
+// nodeFrame is a node being visited, child is the index of the next child to
+// visit. The value of a full node comes first, its branches after it.
+type nodeFrame struct {
+	node  Node
+	hash  []byte
+	path  []byte
+	child int
+	skip  bool // the remaining children aren't visited
+}
+
+func NewNodeIterator(trie *Trie) *NodeIterator {
+	return &NodeIterator{trie: trie}
+}
+
+func (self *Trie) NodeIterator() *NodeIterator {
+	return NewNodeIterator(self)
+}
+
+// Seek restarts the iteration at the first node whose path is at or after
+// the nibbles of key. The nodes above it are skipped.
+func (self *NodeIterator) Seek(key []byte) {
+	self.stack, self.started = nil, false
+	self.start = keyNibbles(key)
+}
+
+// SetEnd stops the iteration before the first node whose path is at or after
+// the nibbles of key. A nil key removes the end.
+func (self *NodeIterator) SetEnd(key []byte) {
+	if key == nil {
+		self.end = nil
+	} else {
+		self.end = keyNibbles(key)
+	}
+}
+
+// SetPrefix restarts the iteration limited to the nodes whose path starts
+// with the nibbles of prefix
+func (self *NodeIterator) SetPrefix(prefix []byte) {
+	self.Seek(prefix)
+
+	// The end is the first path after every path with the prefix, there is
+	// none if the prefix is all 0xf
+	self.end = nil
+	end := keyNibbles(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 15 {
+			end[i]++
+			self.end = end[:i+1]
+			break
+		}
+	}
+}
+
+// Skip makes the next call to Next skip the children of the current node
+func (self *NodeIterator) Skip() {
+	if len(self.stack) > 0 {
+		self.stack[len(self.stack)-1].skip = true
+	}
+}
+
+// Next moves to the next node and reports whether there is one
+func (self *NodeIterator) Next() bool {
+	self.trie.mu.Lock()
+	defer self.trie.mu.Unlock()
+
+	for self.advance() {
+		frame := self.stack[len(self.stack)-1]
+
+		if self.end != nil && bytes.Compare(frame.path, self.end) >= 0 {
+			break
+		}
+		// Nodes before start are skipped, the nodes on the path to start
+		// are descended into
+		if bytes.Compare(frame.path, self.start) < 0 {
+			if !BeginsWith(self.start, frame.path) {
+				self.stack = self.stack[:len(self.stack)-1]
+			}
+			continue
+		}
+
+		self.visit(frame)
+		return true
+	}
+
+	self.stack = nil
+	self.visit(&nodeFrame{})
+
+	return false
+}
+
+// advance pushes the next node in depth first order on the stack
+func (self *NodeIterator) advance() bool {
+	if !self.started {
+		self.started = true
+		if self.trie.root == nil {
+			return false
+		}
+		self.stack = append(self.stack, &nodeFrame{node: self.trie.root, hash: self.trie.roothash})
+
+		return true
+	}
+
+	for len(self.stack) > 0 {
+		frame := self.stack[len(self.stack)-1]
+		if child := self.nextChild(frame); child != nil {
+			self.stack = append(self.stack, child)
+			return true
+		}
+		self.stack = self.stack[:len(self.stack)-1]
+	}
+
+	return false
+}
+
+// nextChild returns the next child of the node of frame, nil if there are no
+// more children
+func (self *NodeIterator) nextChild(frame *nodeFrame) *nodeFrame {
+	if frame.skip {
+		return nil
+	}
+
+	switch node := frame.node.(type) {
+	case *ShortNode:
+		if frame.child > 0 {
+			return nil
+		}
+		frame.child++
+
+		key := node.Key()
+		path := append(append([]byte{}, frame.path...), RemTerm(key)...)
+		if HasTerm(key) {
+			return &nodeFrame{node: &ValueNode{self.trie, valueData(node.value)}, path: path}
+		}
+
+		return self.resolve(node.value, path)
+	case *FullNode:
+		if frame.child == 0 {
+			frame.child++
+			if node.nodes[16] != nil {
+				return &nodeFrame{node: &ValueNode{self.trie, valueData(node.nodes[16])}, path: frame.path}
+			}
+		}
+		for ; frame.child <= 16; frame.child++ {
+			if child := node.nodes[frame.child-1]; child != nil {
+				path := append(append([]byte{}, frame.path...), byte(frame.child-1))
+				frame.child++
+
+				return self.resolve(child, path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolve loads a node stored by hash
+func (self *NodeIterator) resolve(node Node, path []byte) *nodeFrame {
+	if hash, ok := node.(*HashNode); ok {
+		return &nodeFrame{node: self.trie.trans(hash), hash: hash.key, path: path}
+	}
+
+	return &nodeFrame{node: node, path: path}
+}
+
+func (self *NodeIterator) visit(frame *nodeFrame) {
+	self.Node, self.Hash, self.Path = frame.node, frame.hash, frame.path
+
+	self.Leaf, self.Key, self.Value = false, nil, nil
+	if value, ok := frame.node.(*ValueNode); ok {
+		self.Leaf = true
+		self.Key = []byte(DecodeCompact(frame.path))
+		self.Value = value.Val()
+	}
+}
+
+// keyNibbles returns the nibbles of key without the terminator
+func keyNibbles(key []byte) []byte {
+	return RemTerm(CompactHexDecode(string(key)))
+}
@@ -0,0 +1,100 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethutil"
+)
+
+// Prove returns a merkle proof of the value of key, or of its absence. The
+// proof holds the RLP encoding of every node on the path to the key which is
+// referenced by its hash, starting with the root. Nodes shorter than a hash
+// are embedded in their parent.
+func (self *Trie) Prove(key []byte) [][]byte {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	// The empty trie is proven by the encoding of its empty root
+	if self.root == nil {
+		return [][]byte{ethutil.Encode("")}
+	}
+
+	var proof [][]byte
+	add := func(node Node) {
+		if data := ethutil.Encode(node); len(proof) == 0 || len(data) >= 32 {
+			proof = append(proof, data)
+		}
+	}
+
+	k := CompactHexDecode(string(key))
+	for node := self.root; node != nil && len(k) > 0; {
+		if hash, ok := node.(*HashNode); ok {
+			node = self.trans(hash)
+		}
+
+		switch n := node.(type) {
+		case *ShortNode:
+			add(n)
+
+			nkey := n.Key()
+			if len(k) < len(nkey) || !bytes.Equal(nkey, k[:len(nkey)]) {
+				return proof
+			}
+			k, node = k[len(nkey):], n.value
+		case *FullNode:
+			add(n)
+
+			k, node = k[1:], n.nodes[k[0]]
+		default:
+			return proof
+		}
+	}
+
+	return proof
+}
+
+// VerifyProof checks the proof of key against the root hash of a trie and
+// returns the value it proves. The value is nil if the proof shows the key
+// is absent. No database is needed, every node is checked against the hash
+// referencing it.
+func VerifyProof(rootHash, key []byte, proof [][]byte) ([]byte, error) {
+	k := CompactHexDecode(string(key))
+	hash := rootHash
+
+	for i, data := range proof {
+		if !bytes.Equal(crypto.Sha3(data), hash) {
+			return nil, fmt.Errorf("proof node %d: hash mismatch, expected %x", i, hash)
+		}
+
+		node := ethutil.NewValueFromBytes(data)
+		for hash = nil; hash == nil; {
+			// The key is consumed by the terminator, node is the value
+			if len(k) == 0 {
+				return node.Bytes(), nil
+			}
+
+			switch {
+			case node.IsList() && node.Len() == 2:
+				nkey := CompactDecode(string(node.Get(0).Bytes()))
+				if len(k) < len(nkey) || !bytes.Equal(nkey, k[:len(nkey)]) {
+					return nil, nil
+				}
+				k, node = k[len(nkey):], node.Get(1)
+			case node.IsList() && node.Len() == 17:
+				k, node = k[1:], node.Get(int(k[0]))
+			case node.IsList():
+				return nil, fmt.Errorf("proof node %d: invalid node with %d items", i, node.Len())
+			case node.Len() == 0:
+				return nil, nil
+			case node.Len() == 32:
+				hash = node.Bytes()
+			default:
+				return nil, fmt.Errorf("proof node %d: invalid reference %x", i, node.Bytes())
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("proof ends before the path to %x, expected node %x", key, hash)
+}
@@ -0,0 +1,84 @@
+package trie
+
+import (
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethutil"
+)
+
+// Database key prefix of the key preimages of secure tries
+var secureKeyPrefix = []byte("secure-key-")
+
+// SecureTrie is a trie whose keys are hashed with sha3 before they're
+// inserted. Chosen keys can't create long paths, every path is about as long
+// as any other. The preimages of the hashed keys are written to the database
+// on Commit so GetKey can recover the original keys met while iterating.
+type SecureTrie struct {
+	*Trie
+
+	preimages map[string][]byte // preimages of the keys inserted since Commit
+}
+
+func NewSecure(root []byte, backend Backend) *SecureTrie {
+	return &SecureTrie{New(root, backend), make(map[string][]byte)}
+}
+
+func (self *SecureTrie) Copy() *SecureTrie {
+	cpy := NewSecure(self.roothash, self.cache.backend)
+	for hash, key := range self.preimages {
+		cpy.preimages[hash] = key
+	}
+
+	return cpy
+}
+
+func (self *SecureTrie) UpdateString(key, value string) Node {
+	return self.Update([]byte(key), []byte(value))
+}
+func (self *SecureTrie) Update(key, value []byte) Node {
+	hash := crypto.Sha3(key)
+	self.preimages[string(hash)] = ethutil.CopyBytes(key)
+
+	return self.Trie.Update(hash, value)
+}
+
+func (self *SecureTrie) GetString(key string) []byte { return self.Get([]byte(key)) }
+func (self *SecureTrie) Get(key []byte) []byte {
+	return self.Trie.Get(crypto.Sha3(key))
+}
+
+func (self *SecureTrie) DeleteString(key string) Node { return self.Delete([]byte(key)) }
+func (self *SecureTrie) Delete(key []byte) Node {
+	return self.Trie.Delete(crypto.Sha3(key))
+}
+
+// Prove returns a merkle proof of key, verified with VerifyProof against the
+// hashed key
+func (self *SecureTrie) Prove(key []byte) [][]byte {
+	return self.Trie.Prove(crypto.Sha3(key))
+}
+
+// GetKey returns the preimage of a hashed key, or nil if it's unknown
+func (self *SecureTrie) GetKey(hash []byte) []byte {
+	if key, ok := self.preimages[string(hash)]; ok {
+		return key
+	}
+	key, _ := self.cache.backend.Get(append(ethutil.CopyBytes(secureKeyPrefix), hash...))
+
+	return key
+}
+
+// Commit writes the trie and the preimages of its new keys to the database
+func (self *SecureTrie) Commit() {
+	withBatch(self.cache.backend, self.CommitTo)
+}
+
+// CommitTo writes the trie and the preimages of its new keys to db instead of
+// the database
+func (self *SecureTrie) CommitTo(db Writer) {
+	self.Trie.CommitTo(db)
+
+	for hash, key := range self.preimages {
+		db.Put(append(ethutil.CopyBytes(secureKeyPrefix), hash...), key)
+	}
+	self.preimages = make(map[string][]byte)
+}
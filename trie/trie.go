@@ -52,6 +52,12 @@ func (self *Trie) Copy() *Trie {
 	return New(self.roothash, self.cache.backend)
 }
 
+// GetKey returns the key met while iterating as it was inserted. Keys are
+// stored as they are, unlike in a SecureTrie.
+func (self *Trie) GetKey(key []byte) []byte {
+	return key
+}
+
 // Legacy support
 func (self *Trie) Root() []byte { return self.Hash() }
 func (self *Trie) Hash() []byte {
@@ -75,13 +81,19 @@ func (self *Trie) Hash() []byte {
 	return hash
 }
 func (self *Trie) Commit() {
+	withBatch(self.cache.backend, self.CommitTo)
+}
+
+// CommitTo hashes the trie and writes its nodes to db instead of the backend,
+// such as a batch holding other writes as well
+func (self *Trie) CommitTo(db Writer) {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
 	// Hash first
 	self.Hash()
 
-	self.cache.Flush()
+	self.cache.FlushTo(db)
 }
 
 // Reset should only be called if the trie has been hashed
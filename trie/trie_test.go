@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethutil"
 )
 
@@ -152,6 +153,208 @@ func TestReplication(t *testing.T) {
 
 }
 
+func TestWalk(t *testing.T) {
+	trie := NewEmpty()
+	vals := map[string]string{
+		"do":                            "verb",
+		"ether":                         "wookiedoo",
+		"horse":                         "stallion",
+		"doge":                          "coin",
+		"dog":                           "puppy",
+		"somethingveryoddindeedthis is": "myothernodedata",
+	}
+	for k, v := range vals {
+		trie.UpdateString(k, v)
+	}
+	trie.Commit()
+
+	db := trie.cache.backend.(Db)
+	trie2 := New(trie.roothash, db)
+
+	nodes := make(map[string]bool)
+	leaves := make(map[string]bool)
+	trie2.Walk(func(hash []byte) bool {
+		nodes[string(hash)] = true
+		return true
+	}, func(value []byte) {
+		leaves[string(value)] = true
+	})
+
+	if len(nodes) != len(db) {
+		t.Errorf("expected %d nodes, got %d", len(db), len(nodes))
+	}
+	for hash := range nodes {
+		if _, ok := db[hash]; !ok {
+			t.Errorf("walked node %x not in database", hash)
+		}
+	}
+	if len(leaves) != len(vals) {
+		t.Errorf("expected %d leaves, got %d", len(vals), len(leaves))
+	}
+	for _, v := range vals {
+		if !leaves[v] {
+			t.Errorf("expected leaf %q", v)
+		}
+	}
+}
+
+func TestProof(t *testing.T) {
+	trie := NewEmpty()
+	vals := map[string]string{
+		"do":                            "verb",
+		"ether":                         "wookiedoo",
+		"horse":                         "stallion",
+		"doge":                          "coin",
+		"dog":                           "puppy",
+		"somethingveryoddindeedthis is": "myothernodedata",
+		"longvalue":                     "0123456789abcdef0123456789abcdef",
+	}
+	for k, v := range vals {
+		trie.UpdateString(k, v)
+	}
+	trie.Commit()
+	root := trie.Hash()
+
+	// Both the in-memory trie and the trie loaded from the database prove
+	// every key
+	trie2 := New(root, trie.cache.backend)
+	for k, v := range vals {
+		for _, tr := range []*Trie{trie, trie2} {
+			value, err := VerifyProof(root, []byte(k), tr.Prove([]byte(k)))
+			if err != nil {
+				t.Errorf("%s: %v", k, err)
+			} else if string(value) != v {
+				t.Errorf("%s: expected %q got %q", k, v, value)
+			}
+		}
+	}
+
+	for _, k := range []string{"d", "doges", "cat", "somethingveryoddindeedthis"} {
+		value, err := VerifyProof(root, []byte(k), trie2.Prove([]byte(k)))
+		if err != nil || value != nil {
+			t.Errorf("%s: expected proof of absence, got %q (%v)", k, value, err)
+		}
+	}
+
+	// Tampered and truncated proofs are rejected
+	proof := trie2.Prove([]byte("horse"))
+	proof[len(proof)-1] = append(ethutil.CopyBytes(proof[len(proof)-1]), 0)
+	if _, err := VerifyProof(root, []byte("horse"), proof); err == nil {
+		t.Error("expected error for tampered proof")
+	}
+	proof = trie2.Prove([]byte("horse"))
+	if _, err := VerifyProof(root, []byte("horse"), proof[:len(proof)-1]); err == nil {
+		t.Error("expected error for truncated proof")
+	}
+
+	empty := NewEmpty()
+	if value, err := VerifyProof(empty.Hash(), []byte("do"), empty.Prove([]byte("do"))); err != nil || value != nil {
+		t.Errorf("expected proof of absence in empty trie, got %q (%v)", value, err)
+	}
+}
+
+func TestSecureTrie(t *testing.T) {
+	db := make(Db)
+	secure, plain := NewSecure(nil, db), NewEmpty()
+	vals := []struct{ k, v string }{
+		{"do", "verb"},
+		{"ether", "wookiedoo"},
+		{"horse", "stallion"},
+		{"dog", "puppy"},
+	}
+	for _, val := range vals {
+		secure.UpdateString(val.k, val.v)
+		plain.Update(crypto.Sha3([]byte(val.k)), []byte(val.v))
+	}
+	secure.DeleteString("ether")
+	plain.Delete(crypto.Sha3([]byte("ether")))
+	secure.Commit()
+
+	if !bytes.Equal(secure.Hash(), plain.Hash()) {
+		t.Errorf("expected root %x got %x", plain.Hash(), secure.Hash())
+	}
+
+	secure2 := NewSecure(secure.Root(), db)
+	if string(secure2.GetString("horse")) != "stallion" {
+		t.Error("expected to have horse => stallion")
+	}
+	if secure2.GetString("ether") != nil {
+		t.Error("expected ether to be deleted")
+	}
+
+	// The keys are recovered from their preimages
+	keys := make(map[string]bool)
+	it := secure2.Iterator()
+	for it.Next() {
+		keys[string(secure2.GetKey(it.Key))] = true
+	}
+	for _, k := range []string{"do", "horse", "dog"} {
+		if !keys[k] {
+			t.Errorf("expected key %q, got %v", k, keys)
+		}
+	}
+}
+
+func TestCommitTo(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	trie := NewSecure(nil, db)
+	trie.UpdateString("do", "verb")
+	trie.UpdateString("horse", "stallion")
+
+	// Nothing reaches the database before the batch is written
+	batch := db.NewBatch()
+	trie.CommitTo(batch)
+	if trie2 := New(trie.Root(), db); trie2.Get(crypto.Sha3([]byte("horse"))) != nil {
+		t.Error("expected the trie to be written with the batch")
+	}
+
+	batch.Write()
+	trie2 := NewSecure(trie.Root(), db)
+	if string(trie2.GetString("horse")) != "stallion" {
+		t.Error("expected to have horse => stallion")
+	}
+	if key := trie2.GetKey(crypto.Sha3([]byte("do"))); string(key) != "do" {
+		t.Errorf("expected preimage do, got %q", key)
+	}
+}
+
+func TestNodeCache(t *testing.T) {
+	cache := NewNodeCache(2*(10+cacheEntryOverhead) + 5)
+	cache.Put([]byte("a"), make([]byte, 9))
+	cache.Put([]byte("b"), make([]byte, 9))
+	cache.Get([]byte("a"))
+	// b is the least recently used and is evicted
+	cache.Put([]byte("c"), make([]byte, 9))
+
+	if _, ok := cache.Get([]byte("b")); ok {
+		t.Error("expected b to be evicted")
+	}
+	if _, ok := cache.Get([]byte("a")); !ok {
+		t.Error("expected a to be cached")
+	}
+	if size := 2 * (10 + cacheEntryOverhead); cache.Size() != size || cache.Hits() != 2 || cache.Misses() != 1 {
+		t.Errorf("expected size %d, 2 hits and 1 miss, got %d, %d and %d", size, cache.Size(), cache.Hits(), cache.Misses())
+	}
+
+	// Tries opened on the same database share the cache
+	memdb, _ := ethdb.NewMemDatabase()
+	cache = NewNodeCache(1024 * 1024)
+	db := NewCachedDatabase(memdb, cache)
+
+	trie := New(nil, db)
+	trie.UpdateString("dog", "puppy")
+	trie.UpdateString("horse", "stallion")
+	trie.Commit()
+
+	trie2 := New(trie.Root(), db)
+	if string(trie2.GetString("horse")) != "stallion" {
+		t.Error("expected to have horse => stallion")
+	}
+	if cache.Misses() != 0 || cache.Hits() == 0 {
+		t.Errorf("expected the committed nodes to be cached, got %d hits and %d misses", cache.Hits(), cache.Misses())
+	}
+}
+
 func TestReset(t *testing.T) {
 	trie := NewEmpty()
 	vals := []struct{ k, v string }{
@@ -0,0 +1,55 @@
+package trie
+
+// Walk traverses a committed trie. It calls node with the hash of every node
+// stored in the database by hash, parents before their children, and leaf
+// with every value held by the trie. The children of a node for which node
+// returns false aren't visited.
+func (self *Trie) Walk(node func(hash []byte) bool, leaf func(value []byte)) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.root == nil {
+		return
+	}
+	if len(self.roothash) > 0 && !node(self.roothash) {
+		return
+	}
+	self.walk(self.root, node, leaf)
+}
+
+func (self *Trie) walk(n Node, node func([]byte) bool, leaf func([]byte)) {
+	switch n := n.(type) {
+	case *HashNode:
+		if node(n.key) {
+			self.walk(self.trans(n), node, leaf)
+		}
+	case *ShortNode:
+		if HasTerm(n.Key()) {
+			leaf(valueData(n.value))
+		} else {
+			self.walk(n.value, node, leaf)
+		}
+	case *FullNode:
+		for _, child := range n.nodes[:16] {
+			if child != nil {
+				self.walk(child, node, leaf)
+			}
+		}
+		if n.nodes[16] != nil {
+			leaf(valueData(n.nodes[16]))
+		}
+	}
+}
+
+// valueData returns the value held by a leaf. Values of 32 bytes are decoded
+// as hash nodes by mknode.
+func valueData(n Node) []byte {
+	switch n := n.(type) {
+	case *ValueNode:
+		return n.data
+	case *HashNode:
+		return n.key
+	}
+
+	return nil
+}
@@ -12,7 +12,7 @@ type Address interface {
 }
 
 type PrecompiledAccount struct {
-	Gas func(l int) *big.Int
+	Gas func(l int, gas *GasTable) *big.Int
 	fn  func(in []byte) []byte
 }
 
@@ -26,27 +26,27 @@ var Precompiled = PrecompiledContracts()
 func PrecompiledContracts() map[string]*PrecompiledAccount {
 	return map[string]*PrecompiledAccount{
 		// ECRECOVER
-		string(ethutil.LeftPadBytes([]byte{1}, 20)): &PrecompiledAccount{func(l int) *big.Int {
-			return GasEcrecover
+		string(ethutil.LeftPadBytes([]byte{1}, 20)): &PrecompiledAccount{func(l int, gas *GasTable) *big.Int {
+			return gas.Ecrecover
 		}, ecrecoverFunc},
 
 		// SHA256
-		string(ethutil.LeftPadBytes([]byte{2}, 20)): &PrecompiledAccount{func(l int) *big.Int {
+		string(ethutil.LeftPadBytes([]byte{2}, 20)): &PrecompiledAccount{func(l int, gas *GasTable) *big.Int {
 			n := big.NewInt(int64(l+31)/32 + 1)
-			n.Mul(n, GasSha256)
+			n.Mul(n, gas.Sha256)
 			return n
 		}, sha256Func},
 
 		// RIPEMD160
-		string(ethutil.LeftPadBytes([]byte{3}, 20)): &PrecompiledAccount{func(l int) *big.Int {
+		string(ethutil.LeftPadBytes([]byte{3}, 20)): &PrecompiledAccount{func(l int, gas *GasTable) *big.Int {
 			n := big.NewInt(int64(l+31)/32 + 1)
-			n.Mul(n, GasRipemd)
+			n.Mul(n, gas.Ripemd)
 			return n
 		}, ripemd160Func},
 
-		string(ethutil.LeftPadBytes([]byte{4}, 20)): &PrecompiledAccount{func(l int) *big.Int {
+		string(ethutil.LeftPadBytes([]byte{4}, 20)): &PrecompiledAccount{func(l int, gas *GasTable) *big.Int {
 			n := big.NewInt(int64(l+31)/32 + 1)
-			n.Mul(n, GasMemCpy)
+			n.Mul(n, gas.MemCpy)
 
 			return n
 		}, memCpy},
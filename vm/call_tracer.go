@@ -0,0 +1,145 @@
+package vm
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/ethutil"
+)
+
+// CallFrame is a single call of a transaction as recorded by the CallTracer.
+// Calls holds the calls made by this one in the order they were made.
+type CallFrame struct {
+	Type    OpCode
+	From    []byte
+	To      []byte
+	Value   *big.Int
+	Gas     *big.Int
+	GasUsed *big.Int
+	Input   []byte
+	Output  []byte
+	Err     error
+	Calls   []*CallFrame
+}
+
+func (self *CallFrame) MarshalJSON() ([]byte, error) {
+	type callFrameJSON struct {
+		Type    string       `json:"type"`
+		From    string       `json:"from"`
+		To      string       `json:"to"`
+		Value   string       `json:"value"`
+		Gas     string       `json:"gas"`
+		GasUsed string       `json:"gasUsed"`
+		Input   string       `json:"input"`
+		Output  string       `json:"output"`
+		Err     string       `json:"error,omitempty"`
+		Calls   []*CallFrame `json:"calls,omitempty"`
+	}
+
+	enc := callFrameJSON{
+		Type:    self.Type.String(),
+		From:    ethutil.Bytes2Hex(self.From),
+		To:      ethutil.Bytes2Hex(self.To),
+		Value:   self.Value.String(),
+		Gas:     self.Gas.String(),
+		GasUsed: ethutil.Big0.String(),
+		Input:   ethutil.Bytes2Hex(self.Input),
+		Output:  ethutil.Bytes2Hex(self.Output),
+		Calls:   self.Calls,
+	}
+	if self.GasUsed != nil {
+		enc.GasUsed = self.GasUsed.String()
+	}
+	if self.Err != nil {
+		enc.Err = self.Err.Error()
+	}
+
+	return json.Marshal(enc)
+}
+
+// CallTracer is a Tracer recording the tree of calls made by a transaction,
+// including the value transferred by every nested CALL, CALLCODE and CREATE
+type CallTracer struct {
+	root  *CallFrame
+	stack []*CallFrame // frames entered but not yet exited
+}
+
+func NewCallTracer() *CallTracer {
+	return &CallTracer{}
+}
+
+func (self *CallTracer) CaptureStart(from, to []byte, create bool, input []byte, gas, value *big.Int) error {
+	typ := CALL
+	if create {
+		typ = CREATE
+	}
+	self.root = newCallFrame(typ, from, to, input, gas, value)
+	self.stack = []*CallFrame{self.root}
+
+	return nil
+}
+
+func (self *CallTracer) CaptureState(env Environment, pc uint64, op OpCode, gas, cost *big.Int, mem *Memory, stack *Stack, context *Context, depth int) error {
+	return nil
+}
+
+func (self *CallTracer) CaptureFault(env Environment, pc uint64, op OpCode, gas, cost *big.Int, mem *Memory, stack *Stack, context *Context, depth int, err error) error {
+	return nil
+}
+
+func (self *CallTracer) CaptureEnd(output []byte, gasUsed *big.Int, err error) error {
+	if self.root != nil {
+		self.root.finish(output, gasUsed, err)
+	}
+	self.stack = nil
+
+	return nil
+}
+
+func (self *CallTracer) CaptureEnter(typ OpCode, from, to []byte, input []byte, gas, value *big.Int) error {
+	if len(self.stack) == 0 {
+		return nil
+	}
+	frame := newCallFrame(typ, from, to, input, gas, value)
+
+	parent := self.stack[len(self.stack)-1]
+	parent.Calls = append(parent.Calls, frame)
+	self.stack = append(self.stack, frame)
+
+	return nil
+}
+
+func (self *CallTracer) CaptureExit(output []byte, gasUsed *big.Int, err error) error {
+	// The root frame is only finished by CaptureEnd
+	if len(self.stack) <= 1 {
+		return nil
+	}
+	self.stack[len(self.stack)-1].finish(output, gasUsed, err)
+	self.stack = self.stack[:len(self.stack)-1]
+
+	return nil
+}
+
+// Frame returns the outermost call, or nil if nothing was traced
+func (self *CallTracer) Frame() *CallFrame {
+	return self.root
+}
+
+// newCallFrame creates an unfinished frame. Addresses popped off the stack by
+// CALL lack their leading zeroes, they're padded to the full 20 bytes.
+func newCallFrame(typ OpCode, from, to []byte, input []byte, gas, value *big.Int) *CallFrame {
+	return &CallFrame{
+		Type:  typ,
+		From:  ethutil.LeftPadBytes(ethutil.CopyBytes(from), 20),
+		To:    ethutil.LeftPadBytes(ethutil.CopyBytes(to), 20),
+		Value: new(big.Int).Set(value),
+		Gas:   new(big.Int).Set(gas),
+		Input: ethutil.CopyBytes(input),
+	}
+}
+
+func (self *CallFrame) finish(output []byte, gasUsed *big.Int, err error) {
+	self.Output = ethutil.CopyBytes(output)
+	self.GasUsed = new(big.Int).Set(gasUsed)
+	self.Err = err
+}
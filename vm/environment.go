@@ -24,6 +24,17 @@ type Environment interface {
 
 	Depth() int
 	SetDepth(i int)
+	// Depth of the executing call frame as reported to the tracer. Unlike
+	// Depth it drops again when a frame returns.
+	FrameDepth() int
+	SetFrameDepth(i int)
+
+	// Gas prices and instruction set in effect for the current block
+	GasTable() *GasTable
+	JumpTable() *JumpTable
+
+	// Tracer notified of every step of the VM, nil if not tracing
+	Tracer() Tracer
 
 	Call(me ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error)
 	CallCode(me ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error)
@@ -0,0 +1,89 @@
+package vm
+
+import "math/big"
+
+// GasTable holds the gas prices of the VM operations and the intrinsic cost
+// of transactions. The environment hands the VM the table in effect for the
+// block being processed so pricing changes can be scheduled.
+type GasTable struct {
+	Step         *big.Int
+	Sha          *big.Int
+	SLoad        *big.Int
+	SStore       *big.Int
+	SStoreRefund *big.Int
+	Balance      *big.Int
+	Create       *big.Int
+	Call         *big.Int
+	CreateByte   *big.Int
+	Sha3Byte     *big.Int
+	Sha256Byte   *big.Int
+	RipemdByte   *big.Int
+	Memory       *big.Int
+	Data         *big.Int
+	Tx           *big.Int
+	Log          *big.Int
+	Sha256       *big.Int
+	Ripemd       *big.Int
+	Ecrecover    *big.Int
+	MemCpy       *big.Int
+}
+
+// DefaultGasTable returns the gas prices the VM started out with
+func DefaultGasTable() *GasTable {
+	return &GasTable{
+		Step:         big.NewInt(1),
+		Sha:          big.NewInt(10),
+		SLoad:        big.NewInt(20),
+		SStore:       big.NewInt(100),
+		SStoreRefund: big.NewInt(100),
+		Balance:      big.NewInt(20),
+		Create:       big.NewInt(100),
+		Call:         big.NewInt(20),
+		CreateByte:   big.NewInt(5),
+		Sha3Byte:     big.NewInt(10),
+		Sha256Byte:   big.NewInt(50),
+		RipemdByte:   big.NewInt(50),
+		Memory:       big.NewInt(1),
+		Data:         big.NewInt(5),
+		Tx:           big.NewInt(500),
+		Log:          big.NewInt(32),
+		Sha256:       big.NewInt(50),
+		Ripemd:       big.NewInt(50),
+		Ecrecover:    big.NewInt(500),
+		MemCpy:       big.NewInt(1),
+	}
+}
+
+// JumpTable marks the opcodes available to the VM. Instructions that aren't
+// enabled are treated as invalid, which allows new opcodes to be activated
+// from a given block onwards.
+type JumpTable [256]bool
+
+// DefaultJumpTable returns a jump table with every known opcode enabled
+func DefaultJumpTable() *JumpTable {
+	table := new(JumpTable)
+	for op := range opCodeToString {
+		table[op] = true
+	}
+
+	return table
+}
+
+// Enabled returns whether op is part of the instruction set
+func (self *JumpTable) Enabled(op OpCode) bool {
+	return self[op]
+}
+
+// Enable adds the given opcodes to the instruction set
+func (self *JumpTable) Enable(ops ...OpCode) {
+	for _, op := range ops {
+		self[op] = true
+	}
+}
+
+// Disable removes the given opcodes from the instruction set
+func (self *JumpTable) Disable(ops ...OpCode) {
+	for _, op := range ops {
+		self[op] = false
+	}
+}
@@ -0,0 +1,226 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/ethutil"
+)
+
+// LogConfig selects what the StructLogger records for every step
+type LogConfig struct {
+	DisableMemory  bool
+	DisableStack   bool
+	DisableStorage bool
+	// Maximum number of steps recorded, 0 means no limit
+	Limit int
+}
+
+// StructLog is a single step of the VM as recorded by the StructLogger.
+// Storage holds the storage slots of the executing contract changed so far.
+type StructLog struct {
+	Pc      uint64
+	Op      OpCode
+	Gas     *big.Int
+	GasCost *big.Int
+	Depth   int
+	Stack   []*big.Int
+	Memory  []byte
+	Storage map[string][]byte
+	Err     error
+}
+
+func (self *StructLog) MarshalJSON() ([]byte, error) {
+	type structLogJSON struct {
+		Pc      uint64            `json:"pc"`
+		Op      string            `json:"op"`
+		Gas     string            `json:"gas"`
+		GasCost string            `json:"gasCost"`
+		Depth   int               `json:"depth"`
+		Stack   []string          `json:"stack"`
+		Memory  []string          `json:"memory"`
+		Storage map[string]string `json:"storage"`
+		Err     string            `json:"error,omitempty"`
+	}
+
+	enc := structLogJSON{
+		Pc:      self.Pc,
+		Op:      self.Op.String(),
+		Gas:     self.Gas.String(),
+		GasCost: self.GasCost.String(),
+		Depth:   self.Depth,
+		Stack:   make([]string, len(self.Stack)),
+		Memory:  make([]string, 0, len(self.Memory)/32),
+		Storage: make(map[string]string, len(self.Storage)),
+	}
+	for i, value := range self.Stack {
+		enc.Stack[i] = ethutil.Bytes2Hex(ethutil.LeftPadBytes(value.Bytes(), 32))
+	}
+	for i := 0; i+32 <= len(self.Memory); i += 32 {
+		enc.Memory = append(enc.Memory, ethutil.Bytes2Hex(self.Memory[i:i+32]))
+	}
+	for key, value := range self.Storage {
+		enc.Storage[ethutil.Bytes2Hex([]byte(key))] = ethutil.Bytes2Hex(value)
+	}
+	if self.Err != nil {
+		enc.Err = self.Err.Error()
+	}
+
+	return json.Marshal(enc)
+}
+
+// StructLogger is a Tracer recording every step of the VM
+type StructLogger struct {
+	cfg LogConfig
+
+	logs []StructLog
+	// Changed storage by contract address, one set per entered call frame.
+	// The changes of a frame are merged into its caller's when it returns
+	// and dropped when it fails, as the state then reverts them.
+	changed []map[string]map[string][]byte
+
+	output  []byte
+	gasUsed *big.Int
+	err     error
+}
+
+func NewStructLogger(cfg *LogConfig) *StructLogger {
+	logger := &StructLogger{changed: []map[string]map[string][]byte{make(map[string]map[string][]byte)}}
+	if cfg != nil {
+		logger.cfg = *cfg
+	}
+
+	return logger
+}
+
+func (self *StructLogger) CaptureStart(from, to []byte, create bool, input []byte, gas, value *big.Int) error {
+	return nil
+}
+
+func (self *StructLogger) CaptureState(env Environment, pc uint64, op OpCode, gas, cost *big.Int, mem *Memory, stack *Stack, context *Context, depth int) error {
+	return self.capture(pc, op, gas, cost, mem, stack, context, depth, nil)
+}
+
+func (self *StructLogger) CaptureFault(env Environment, pc uint64, op OpCode, gas, cost *big.Int, mem *Memory, stack *Stack, context *Context, depth int, err error) error {
+	return self.capture(pc, op, gas, cost, mem, stack, context, depth, err)
+}
+
+func (self *StructLogger) capture(pc uint64, op OpCode, gas, cost *big.Int, mem *Memory, stack *Stack, context *Context, depth int, err error) error {
+	if self.cfg.Limit != 0 && len(self.logs) >= self.cfg.Limit {
+		return nil
+	}
+
+	log := StructLog{
+		Pc:      pc,
+		Op:      op,
+		Gas:     new(big.Int).Set(gas),
+		GasCost: new(big.Int).Set(cost),
+		Depth:   depth,
+		Err:     err,
+	}
+	if !self.cfg.DisableMemory {
+		log.Memory = ethutil.CopyBytes(mem.Data())
+	}
+	if !self.cfg.DisableStack {
+		log.Stack = make([]*big.Int, stack.Len())
+		for i, value := range stack.Data() {
+			log.Stack[i] = new(big.Int).Set(value)
+		}
+	}
+	if !self.cfg.DisableStorage {
+		addr := string(context.Address())
+		// The slot is written by this step, the stack holds the location on
+		// top of the value
+		if op == SSTORE && stack.Len() >= 2 {
+			frame := self.changed[len(self.changed)-1]
+			if frame[addr] == nil {
+				frame[addr] = make(map[string][]byte)
+			}
+			data := stack.Data()
+			loc, value := data[len(data)-1], data[len(data)-2]
+			frame[addr][string(ethutil.LeftPadBytes(loc.Bytes(), 32))] = ethutil.LeftPadBytes(value.Bytes(), 32)
+		}
+
+		log.Storage = make(map[string][]byte)
+		for _, frame := range self.changed {
+			for key, value := range frame[addr] {
+				log.Storage[key] = value
+			}
+		}
+	}
+	self.logs = append(self.logs, log)
+
+	return nil
+}
+
+func (self *StructLogger) CaptureEnd(output []byte, gasUsed *big.Int, err error) error {
+	self.output = output
+	self.gasUsed = gasUsed
+	self.err = err
+
+	return nil
+}
+
+func (self *StructLogger) CaptureEnter(typ OpCode, from, to []byte, input []byte, gas, value *big.Int) error {
+	self.changed = append(self.changed, make(map[string]map[string][]byte))
+
+	return nil
+}
+
+func (self *StructLogger) CaptureExit(output []byte, gasUsed *big.Int, err error) error {
+	last := len(self.changed) - 1
+	frame := self.changed[last]
+	self.changed = self.changed[:last]
+	if err != nil {
+		return nil
+	}
+
+	parent := self.changed[last-1]
+	for addr, slots := range frame {
+		if parent[addr] == nil {
+			parent[addr] = make(map[string][]byte)
+		}
+		for key, value := range slots {
+			parent[addr][key] = value
+		}
+	}
+
+	return nil
+}
+
+// StructLogs returns the recorded steps
+func (self *StructLogger) StructLogs() []StructLog {
+	return self.logs
+}
+
+// Output returns the return data of the traced call
+func (self *StructLogger) Output() []byte {
+	return self.output
+}
+
+// GasUsed returns the gas used by the traced call
+func (self *StructLogger) GasUsed() *big.Int {
+	return self.gasUsed
+}
+
+// Error returns the error the traced call failed with, if any
+func (self *StructLogger) Error() error {
+	return self.err
+}
+
+// WriteTrace writes logs to w as JSON, one step per line
+func WriteTrace(w io.Writer, logs []StructLog) error {
+	for i := range logs {
+		enc, err := json.Marshal(&logs[i])
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", enc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package vm
+
+import "math/big"
+
+// Tracer is notified of every step of the VM. CaptureStart and CaptureEnd
+// are called once for the outermost call, CaptureEnter and CaptureExit for
+// every nested CALL, CALLCODE and CREATE. CaptureState is called before each
+// opcode is executed at any depth and CaptureFault when executing an opcode
+// failed. Returning an error from CaptureState aborts the execution with that
+// error.
+type Tracer interface {
+	CaptureStart(from, to []byte, create bool, input []byte, gas, value *big.Int) error
+	CaptureState(env Environment, pc uint64, op OpCode, gas, cost *big.Int, mem *Memory, stack *Stack, context *Context, depth int) error
+	CaptureFault(env Environment, pc uint64, op OpCode, gas, cost *big.Int, mem *Memory, stack *Stack, context *Context, depth int, err error) error
+	CaptureEnd(output []byte, gasUsed *big.Int, err error) error
+	CaptureEnter(typ OpCode, from, to []byte, input []byte, gas, value *big.Int) error
+	CaptureExit(output []byte, gasUsed *big.Int, err error) error
+}
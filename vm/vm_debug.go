@@ -17,13 +17,6 @@ type DebugVm struct {
 
 	err error
 
-	// Debugging
-	Dbg Debugger
-
-	BreakPoints []int64
-	Stepping    bool
-	Fn          string
-
 	Recoverable bool
 }
 
@@ -39,6 +32,10 @@ func NewDebugVm(env Environment) *DebugVm {
 func (self *DebugVm) Run(me, caller ContextRef, code []byte, value, gas, price *big.Int, callData []byte) (ret []byte, err error) {
 	self.env.SetDepth(self.env.Depth() + 1)
 
+	depth := self.env.FrameDepth() + 1
+	self.env.SetFrameDepth(depth)
+	defer self.env.SetFrameDepth(depth - 1)
+
 	msg := self.env.State().Manifest().AddMessage(&state.Message{
 		To: me.Address(), From: caller.Address(),
 		Input:     callData,
@@ -50,12 +47,27 @@ func (self *DebugVm) Run(me, caller ContextRef, code []byte, value, gas, price *
 
 	vmlogger.Debugf("(%d) (%x) %x (code=%d) gas: %v (d) %x\n", self.env.Depth(), caller.Address()[:4], context.Address(), len(code), context.Gas, callData)
 
+	var (
+		op OpCode
+
+		mem              = NewMemory()
+		stack            = NewStack()
+		pc        uint64 = 0
+		cost             = new(big.Int)
+		remaining        = new(big.Int) // gas before the current step
+		tracer           = self.env.Tracer()
+	)
+
 	if self.Recoverable {
 		// Recover from any require exception
 		defer func() {
 			if r := recover(); r != nil {
 				self.Printf(" %v", r).Endl()
 
+				if tracer != nil {
+					tracer.CaptureFault(self.env, pc, op, remaining, cost, mem, stack, context, depth, fmt.Errorf("%v", r))
+				}
+
 				context.UseGas(context.Gas)
 
 				ret = context.Return(nil)
@@ -71,15 +83,9 @@ func (self *DebugVm) Run(me, caller ContextRef, code []byte, value, gas, price *
 	}
 
 	var (
-		op OpCode
-
-		destinations        = analyseJumpDests(context.Code)
-		mem                 = NewMemory()
-		stack               = NewStack()
-		pc           uint64 = 0
-		step                = 0
-		prevStep            = 0
-		statedb             = self.env.State()
+		destinations = analyseJumpDests(context.Code)
+		jumpTable    = self.env.JumpTable()
+		statedb      = self.env.State()
 
 		jump = func(from uint64, to *big.Int) {
 			p := to.Uint64()
@@ -102,28 +108,48 @@ func (self *DebugVm) Run(me, caller ContextRef, code []byte, value, gas, price *
 	}
 
 	for {
-		prevStep = step
 		// The base for all big integer arithmetic
 		base := new(big.Int)
 
-		step++
 		// Get the memory location of pc
 		op = context.GetOp(pc)
 
 		self.Printf("(pc) %-3d -o- %-14s (m) %-4d (s) %-4d ", pc, op.String(), mem.Len(), stack.Len())
 
-		newMemSize, gas := self.calculateGasAndSize(context, caller, op, statedb, mem, stack)
+		// Opcodes outside of the active instruction set are invalid
+		if !jumpTable.Enabled(op) {
+			vmlogger.Debugf("(pc) %-3v Invalid opcode %x\n", pc, op)
+
+			panic(fmt.Errorf("Invalid opcode %x", op))
+		}
+
+		remaining.Set(context.Gas)
+		var newMemSize *big.Int
+		newMemSize, cost = self.calculateGasAndSize(context, caller, op, statedb, mem, stack)
 
-		self.Printf("(g) %-3v (%v)", gas, context.Gas)
+		self.Printf("(g) %-3v (%v)", cost, context.Gas)
 
-		if !context.UseGas(gas) {
+		if tracer != nil {
+			if err := tracer.CaptureState(self.env, pc, op, remaining, cost, mem, stack, context, depth); err != nil {
+				context.UseGas(context.Gas)
+
+				return context.Return(nil), err
+			}
+		}
+
+		if !context.UseGas(cost) {
 			self.Endl()
 
 			tmp := new(big.Int).Set(context.Gas)
 
 			context.UseGas(context.Gas)
 
-			return context.Return(nil), OOG(gas, tmp)
+			err := OOG(cost, tmp)
+			if tracer != nil {
+				tracer.CaptureFault(self.env, pc, op, remaining, cost, mem, stack, context, depth, err)
+			}
+
+			return context.Return(nil), err
 		}
 
 		mem.Resize(newMemSize.Uint64())
@@ -559,8 +585,6 @@ func (self *DebugVm) Run(me, caller ContextRef, code []byte, value, gas, price *
 			stack.Push(ethutil.BigD(byts))
 			pc += a
 
-			step += int(op) - int(PUSH1) + 1
-
 			self.Printf(" => 0x%x", byts)
 		case POP:
 			stack.Pop()
@@ -660,7 +684,7 @@ func (self *DebugVm) Run(me, caller ContextRef, code []byte, value, gas, price *
 
 				// gas < len(ret) * CreateDataGas == NO_CODE
 				dataGas := big.NewInt(int64(len(ret)))
-				dataGas.Mul(dataGas, GasCreateByte)
+				dataGas.Mul(dataGas, self.env.GasTable().CreateByte)
 				if context.UseGas(dataGas) {
 					ref.SetCode(ret)
 					msg.Output = ret
@@ -671,11 +695,6 @@ func (self *DebugVm) Run(me, caller ContextRef, code []byte, value, gas, price *
 
 				self.Printf(" (*) %x", addr)
 			}
-
-			// Debug hook
-			if self.Dbg != nil {
-				self.Dbg.SetCode(context.Code)
-			}
 		case CALL, CALLCODE:
 			self.Endl()
 
@@ -712,11 +731,6 @@ func (self *DebugVm) Run(me, caller ContextRef, code []byte, value, gas, price *
 			}
 			self.Printf("resume %x (%v)", context.Address(), context.Gas)
 
-			// Debug hook
-			if self.Dbg != nil {
-				self.Dbg.SetCode(context.Code)
-			}
-
 		case RETURN:
 			size, offset := stack.Popn()
 			ret := mem.Get(offset.Int64(), size.Int64())
@@ -747,27 +761,11 @@ func (self *DebugVm) Run(me, caller ContextRef, code []byte, value, gas, price *
 		pc++
 
 		self.Endl()
-
-		if self.Dbg != nil {
-			for _, instrNo := range self.Dbg.BreakPoints() {
-				if pc == uint64(instrNo) {
-					self.Stepping = true
-
-					if !self.Dbg.BreakHook(prevStep, op, mem, stack, statedb.GetStateObject(context.Address())) {
-						return nil, nil
-					}
-				} else if self.Stepping {
-					if !self.Dbg.StepHook(prevStep, op, mem, stack, statedb.GetStateObject(context.Address())) {
-						return nil, nil
-					}
-				}
-			}
-		}
-
 	}
 }
 
 func (self *DebugVm) calculateGasAndSize(context *Context, caller ContextRef, op OpCode, statedb *state.StateDB, mem *Memory, stack *Stack) (*big.Int, *big.Int) {
+	gasTable := self.env.GasTable()
 	gas := new(big.Int)
 	addStepGasUsage := func(amount *big.Int) {
 		if amount.Cmp(ethutil.Big0) >= 0 {
@@ -775,7 +773,7 @@ func (self *DebugVm) calculateGasAndSize(context *Context, caller ContextRef, op
 		}
 	}
 
-	addStepGasUsage(GasStep)
+	addStepGasUsage(gasTable.Step)
 
 	var newMemSize *big.Int = ethutil.Big0
 	var additionalGas *big.Int = new(big.Int)
@@ -798,8 +796,8 @@ func (self *DebugVm) calculateGasAndSize(context *Context, caller ContextRef, op
 		n := int(op - LOG0)
 		stack.require(n + 2)
 
-		gas.Set(GasLog)
-		addStepGasUsage(new(big.Int).Mul(big.NewInt(int64(n)), GasLog))
+		gas.Set(gasTable.Log)
+		addStepGasUsage(new(big.Int).Mul(big.NewInt(int64(n)), gasTable.Log))
 
 		mSize, mStart := stack.Peekn()
 		addStepGasUsage(mSize)
@@ -819,7 +817,7 @@ func (self *DebugVm) calculateGasAndSize(context *Context, caller ContextRef, op
 	case SLOAD:
 		stack.require(1)
 
-		gas.Set(GasSLoad)
+		gas.Set(gasTable.SLoad)
 	// Memory resize & Gas
 	case SSTORE:
 		stack.require(2)
@@ -831,17 +829,17 @@ func (self *DebugVm) calculateGasAndSize(context *Context, caller ContextRef, op
 			// 0 => non 0
 			mult = ethutil.Big3
 		} else if len(val) > 0 && len(y.Bytes()) == 0 {
-			statedb.Refund(caller.Address(), GasSStoreRefund)
+			statedb.Refund(caller.Address(), gasTable.SStoreRefund)
 
 			mult = ethutil.Big0
 		} else {
 			// non 0 => non 0 (or 0 => 0)
 			mult = ethutil.Big1
 		}
-		gas.Set(new(big.Int).Mul(mult, GasSStore))
+		gas.Set(new(big.Int).Mul(mult, gasTable.SStore))
 	case BALANCE:
 		stack.require(1)
-		gas.Set(GasBalance)
+		gas.Set(gasTable.Balance)
 	case MSTORE:
 		stack.require(2)
 		newMemSize = calcMemSize(stack.Peek(), u256(32))
@@ -858,7 +856,7 @@ func (self *DebugVm) calculateGasAndSize(context *Context, caller ContextRef, op
 		newMemSize = calcMemSize(stack.Peek(), stack.data[stack.Len()-2])
 	case SHA3:
 		stack.require(2)
-		gas.Set(GasSha)
+		gas.Set(gasTable.Sha)
 		newMemSize = calcMemSize(stack.Peek(), stack.data[stack.Len()-2])
 		additionalGas.Set(stack.data[stack.Len()-2])
 	case CALLDATACOPY:
@@ -878,7 +876,7 @@ func (self *DebugVm) calculateGasAndSize(context *Context, caller ContextRef, op
 		additionalGas.Set(stack.data[stack.Len()-4])
 	case CALL, CALLCODE:
 		stack.require(7)
-		gas.Set(GasCall)
+		gas.Set(gasTable.Call)
 		addStepGasUsage(stack.data[stack.Len()-1])
 
 		x := calcMemSize(stack.data[stack.Len()-6], stack.data[stack.Len()-7])
@@ -887,7 +885,7 @@ func (self *DebugVm) calculateGasAndSize(context *Context, caller ContextRef, op
 		newMemSize = ethutil.BigMax(x, y)
 	case CREATE:
 		stack.require(3)
-		gas.Set(GasCreate)
+		gas.Set(gasTable.Create)
 
 		newMemSize = calcMemSize(stack.data[stack.Len()-2], stack.data[stack.Len()-3])
 	}
@@ -900,7 +898,7 @@ func (self *DebugVm) calculateGasAndSize(context *Context, caller ContextRef, op
 	case SHA3:
 		additionalGas.Add(additionalGas, u256(31))
 		additionalGas.Div(additionalGas, u256(32))
-		additionalGas.Mul(additionalGas, GasSha3Byte)
+		additionalGas.Mul(additionalGas, gasTable.Sha3Byte)
 		addStepGasUsage(additionalGas)
 	}
 
@@ -911,7 +909,7 @@ func (self *DebugVm) calculateGasAndSize(context *Context, caller ContextRef, op
 
 		if newMemSize.Cmp(u256(int64(mem.Len()))) > 0 {
 			memGasUsage := new(big.Int).Sub(newMemSize, u256(int64(mem.Len())))
-			memGasUsage.Mul(GasMemory, memGasUsage)
+			memGasUsage.Mul(gasTable.Memory, memGasUsage)
 			memGasUsage.Div(memGasUsage, u256(32))
 
 			addStepGasUsage(memGasUsage)
@@ -923,7 +921,7 @@ func (self *DebugVm) calculateGasAndSize(context *Context, caller ContextRef, op
 }
 
 func (self *DebugVm) RunPrecompiled(p *PrecompiledAccount, callData []byte, context *Context) (ret []byte, err error) {
-	gas := p.Gas(len(callData))
+	gas := p.Gas(len(callData), self.env.GasTable())
 	if context.UseGas(gas) {
 		ret = p.Call(callData)
 		self.Printf("NATIVE_FUNC => %x", ret)
@@ -1,3 +1,137 @@
 package vm
 
 // Tests have been removed in favour of general tests. If anything implementation specific needs testing, put it here
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethutil"
+	"github.com/ethereum/go-ethereum/state"
+)
+
+func init() {
+	ethutil.ReadConfig("/tmp/ethtest", "/tmp/ethtest", "ETH")
+}
+
+// tracerEnv is a bare environment running a single context with a tracer
+type tracerEnv struct {
+	state      *state.StateDB
+	depth      int
+	frameDepth int
+	tracer     Tracer
+}
+
+func (self *tracerEnv) State() *state.StateDB                            { return self.state }
+func (self *tracerEnv) Origin() []byte                                   { return nil }
+func (self *tracerEnv) BlockNumber() *big.Int                            { return ethutil.Big0 }
+func (self *tracerEnv) GetHash(n uint64) []byte                          { return nil }
+func (self *tracerEnv) Coinbase() []byte                                 { return nil }
+func (self *tracerEnv) Time() int64                                      { return 0 }
+func (self *tracerEnv) Difficulty() *big.Int                             { return ethutil.Big0 }
+func (self *tracerEnv) GasLimit() *big.Int                               { return ethutil.Big0 }
+func (self *tracerEnv) Transfer(from, to Account, amount *big.Int) error { return nil }
+func (self *tracerEnv) AddLog(state.Log)                                 {}
+func (self *tracerEnv) Depth() int                                       { return self.depth }
+func (self *tracerEnv) SetDepth(i int)                                   { self.depth = i }
+func (self *tracerEnv) FrameDepth() int                                  { return self.frameDepth }
+func (self *tracerEnv) SetFrameDepth(i int)                              { self.frameDepth = i }
+func (self *tracerEnv) GasTable() *GasTable                              { return DefaultGasTable() }
+func (self *tracerEnv) JumpTable() *JumpTable                            { return DefaultJumpTable() }
+func (self *tracerEnv) Tracer() Tracer                                   { return self.tracer }
+func (self *tracerEnv) Call(me ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error) {
+	return nil, nil
+}
+func (self *tracerEnv) CallCode(me ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error) {
+	return nil, nil
+}
+func (self *tracerEnv) Create(me ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error, ContextRef) {
+	return nil, nil, nil
+}
+
+func TestStructLogger(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	logger := NewStructLogger(nil)
+	env := &tracerEnv{state: state.New(nil, db), tracer: logger}
+
+	caller := env.state.GetOrNewStateObject([]byte("caller"))
+	contract := env.state.GetOrNewStateObject([]byte("contract"))
+	// PUSH1 0x2a PUSH1 0x01 SSTORE STOP
+	code := []byte{byte(PUSH1), 0x2a, byte(PUSH1), 0x01, byte(SSTORE), byte(STOP)}
+	if _, err := NewDebugVm(env).Run(contract, caller, code, ethutil.Big0, big.NewInt(100000), ethutil.Big0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := logger.StructLogs()
+	if len(logs) != 4 {
+		t.Fatalf("expected 4 steps, got %d", len(logs))
+	}
+	for i, op := range []OpCode{PUSH1, PUSH1, SSTORE, STOP} {
+		if logs[i].Op != op || logs[i].Depth != 1 {
+			t.Errorf("step %d: got %v at depth %d, want %v at depth 1", i, logs[i].Op, logs[i].Depth, op)
+		}
+	}
+	if logs[1].Pc != 2 || len(logs[2].Stack) != 2 {
+		t.Errorf("unexpected pc %d or stack size %d", logs[1].Pc, len(logs[2].Stack))
+	}
+	if logs[0].Gas.Cmp(new(big.Int).Add(logs[1].Gas, logs[0].GasCost)) != 0 {
+		t.Errorf("gas mismatch: %v - %v != %v", logs[0].Gas, logs[0].GasCost, logs[1].Gas)
+	}
+	if env.frameDepth != 0 {
+		t.Errorf("frame depth not restored, got %d", env.frameDepth)
+	}
+
+	enc, err := json.Marshal(&logs[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dec struct {
+		Op      string            `json:"op"`
+		Storage map[string]string `json:"storage"`
+	}
+	if err := json.Unmarshal(enc, &dec); err != nil {
+		t.Fatal(err)
+	}
+	key := "0000000000000000000000000000000000000000000000000000000000000001"
+	if dec.Op != "STOP" || dec.Storage[key] != "000000000000000000000000000000000000000000000000000000000000002a" {
+		t.Errorf("unexpected encoding: %s", enc)
+	}
+}
+
+func TestStructLoggerRevert(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb := state.New(nil, db)
+	contract := statedb.GetOrNewStateObject([]byte("contract"))
+	context := NewContext(contract, contract, nil, big.NewInt(100000), ethutil.Big0)
+
+	logger := NewStructLogger(nil)
+	step := func(op OpCode, depth int, values ...int64) {
+		stack := NewStack()
+		for _, value := range values {
+			stack.Push(big.NewInt(value))
+		}
+		logger.CaptureState(nil, 0, op, ethutil.Big0, ethutil.Big0, NewMemory(), stack, context, depth)
+	}
+
+	// The contract writes slot 1 and calls itself twice, writing slot 2 in a
+	// call which fails and slot 3 in one which succeeds
+	step(SSTORE, 1, 1, 1)
+	logger.CaptureEnter(CALL, contract.Address(), contract.Address(), nil, ethutil.Big0, ethutil.Big0)
+	step(SSTORE, 2, 2, 2)
+	logger.CaptureExit(nil, ethutil.Big0, errors.New("out of gas"))
+	logger.CaptureEnter(CALL, contract.Address(), contract.Address(), nil, ethutil.Big0, ethutil.Big0)
+	step(SSTORE, 2, 3, 3)
+	logger.CaptureExit(nil, ethutil.Big0, nil)
+	step(STOP, 1)
+
+	logs := logger.StructLogs()
+	storage := logs[len(logs)-1].Storage
+	for slot, changed := range map[int64]bool{1: true, 2: false, 3: true} {
+		if _, ok := storage[string(ethutil.LeftPadBytes(big.NewInt(slot).Bytes(), 32))]; ok != changed {
+			t.Errorf("slot %d: changed %v, want %v", slot, ok, changed)
+		}
+	}
+}
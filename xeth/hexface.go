@@ -3,12 +3,15 @@ package xeth
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethutil"
 	"github.com/ethereum/go-ethereum/state"
+	"github.com/ethereum/go-ethereum/vm"
 )
 
 type JSXEth struct {
@@ -46,6 +49,91 @@ func (self *JSXEth) Block(v interface{}) *JSBlock {
 	return nil
 }
 
+func (self *JSXEth) Transaction(strHash string) *JSTransaction {
+	tx, blockHash, _ := self.obj.ChainManager().GetTransaction(fromHex(strHash))
+	if tx == nil {
+		return nil
+	}
+
+	jstx := NewJSTx(tx)
+	if block := self.obj.ChainManager().GetBlock(blockHash); block != nil {
+		jstx.Confirmations = int(self.obj.ChainManager().CurrentBlock().NumberU64()-block.NumberU64()) + 1
+	}
+
+	return jstx
+}
+
+func (self *JSXEth) Receipt(strHash string) *JSTxReceipt {
+	hash := fromHex(strHash)
+	tx, blockHash, index := self.obj.ChainManager().GetTransaction(hash)
+	if tx == nil {
+		return nil
+	}
+
+	receipt := self.obj.ChainManager().GetReceipt(hash)
+	if receipt == nil {
+		return nil
+	}
+
+	return NewJSTxReceipt(tx, self.obj.ChainManager().GetBlock(blockHash), index, receipt)
+}
+
+// TraceTransaction re-executes the transaction with the given hash and returns
+// every step the VM took. A transaction failing on replay isn't an error, the
+// failure is reported in the trace.
+func (self *JSXEth) TraceTransaction(strHash string) (*JSTrace, error) {
+	logger := vm.NewStructLogger(nil)
+	err := self.traceTransaction(strHash, logger)
+	if err == errTxNotFound {
+		return nil, fmt.Errorf("transaction %s not found", strHash)
+	}
+	trace := NewJSTrace(logger)
+	if err != nil {
+		trace.Error = err.Error()
+	}
+
+	return trace, nil
+}
+
+// TraceCalls re-executes the transaction with the given hash and returns the
+// tree of calls it made
+func (self *JSXEth) TraceCalls(strHash string) (*vm.CallFrame, error) {
+	tracer := vm.NewCallTracer()
+	err := self.traceTransaction(strHash, tracer)
+	if err == errTxNotFound {
+		return nil, fmt.Errorf("transaction %s not found", strHash)
+	}
+	// Without a frame the transaction failed before reaching the VM
+	if tracer.Frame() == nil {
+		if err == nil {
+			err = fmt.Errorf("transaction %s made no calls", strHash)
+		}
+		return nil, err
+	}
+
+	return tracer.Frame(), nil
+}
+
+var errTxNotFound = errors.New("transaction not found")
+
+func (self *JSXEth) traceTransaction(strHash string, tracer vm.Tracer) error {
+	hash := fromHex(strHash)
+	if tx, _, _ := self.obj.ChainManager().GetTransaction(hash); tx == nil {
+		return errTxNotFound
+	}
+	_, err := self.obj.BlockProcessor().TraceTransaction(hash, tracer)
+
+	return err
+}
+
+func (self *JSXEth) SetHead(num int) error {
+	if num < 0 {
+		return fmt.Errorf("invalid block number %d", num)
+	}
+
+	return self.obj.ChainManager().SetHead(uint64(num))
+}
+
 func (self *JSXEth) Key() *JSKey {
 	return NewJSKey(self.obj.KeyManager().KeyPair())
 }
@@ -92,21 +180,104 @@ func (self *JSXEth) NumberToHuman(balance string) string {
 }
 
 func (self *JSXEth) StorageAt(addr, storageAddr string) string {
-	storage := self.World().SafeGet(fromHex(addr)).Storage(fromHex(storageAddr))
+	storage, _ := self.StorageAtBlock(addr, storageAddr, "latest")
 
-	return toHex(storage.Bytes())
+	return storage
 }
 
 func (self *JSXEth) BalanceAt(addr string) string {
-	return self.World().SafeGet(fromHex(addr)).Balance().String()
+	balance, _ := self.BalanceAtBlock(addr, "latest")
+
+	return balance
 }
 
 func (self *JSXEth) TxCountAt(address string) int {
-	return int(self.World().SafeGet(fromHex(address)).Nonce)
+	count, _ := self.TxCountAtBlock(address, "latest")
+
+	return count
 }
 
 func (self *JSXEth) CodeAt(address string) string {
-	return toHex(self.World().SafeGet(fromHex(address)).Code)
+	code, _ := self.CodeAtBlock(address, "latest")
+
+	return code
+}
+
+// The AtBlock accessors read the state of the block chosen by block, see
+// World.StateAt for the accepted selectors
+
+func (self *JSXEth) StorageAtBlock(addr, storageAddr, block string) (string, error) {
+	object, err := self.World().SafeGetAt(fromHex(addr), block)
+	if err != nil {
+		return "", err
+	}
+
+	return toHex(object.Storage(fromHex(storageAddr)).Bytes()), nil
+}
+
+func (self *JSXEth) BalanceAtBlock(addr, block string) (string, error) {
+	object, err := self.World().SafeGetAt(fromHex(addr), block)
+	if err != nil {
+		return "", err
+	}
+
+	return object.Balance().String(), nil
+}
+
+func (self *JSXEth) TxCountAtBlock(address, block string) (int, error) {
+	object, err := self.World().SafeGetAt(fromHex(address), block)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(object.Nonce), nil
+}
+
+func (self *JSXEth) CodeAtBlock(address, block string) (string, error) {
+	object, err := self.World().SafeGetAt(fromHex(address), block)
+	if err != nil {
+		return "", err
+	}
+
+	return toHex(object.Code), nil
+}
+
+// ProofAtBlock returns the account at addr in the state of the block chosen by
+// block with the merkle proofs of the account and of the storage slots keys.
+// The pending state isn't supported.
+func (self *JSXEth) ProofAtBlock(addr string, keys []string, block string) (*JSProof, error) {
+	statedb, err := self.World().CommittedStateAt(block)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make([][]byte, len(keys))
+	for i, key := range keys {
+		slots[i] = fromHex(key)
+	}
+
+	return NewJSProof(statedb, self.World().safeGetFrom(statedb, fromHex(addr)), slots), nil
+}
+
+// StateDiff returns the accounts changed between the states of the blocks
+// chosen by from and to, see World.CommittedStateAt for the accepted selectors
+func (self *JSXEth) StateDiff(from, to string) ([]*JSAccountDiff, error) {
+	fromState, err := self.World().CommittedStateAt(from)
+	if err != nil {
+		return nil, err
+	}
+	toState, err := self.World().CommittedStateAt(to)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := state.Diff(fromState, toState)
+	jsdiffs := make([]*JSAccountDiff, len(diffs))
+	for i, diff := range diffs {
+		jsdiffs[i] = NewJSAccountDiff(diff)
+	}
+
+	return jsdiffs, nil
 }
 
 func (self *JSXEth) IsContract(address string) bool {
@@ -144,7 +315,7 @@ func (self *JSXEth) EachStorage(addr string) string {
 	object := self.World().SafeGet(fromHex(addr))
 	it := object.Trie().Iterator()
 	for it.Next() {
-		values = append(values, KeyVal{toHex(it.Key), toHex(it.Value)})
+		values = append(values, KeyVal{toHex(object.Trie().GetKey(it.Key)), toHex(it.Value)})
 	}
 
 	valuesJson, err := json.Marshal(values)
@@ -208,7 +379,7 @@ func (self *JSXEth) Transact(key, toStr, valueStr, gasStr, gasPriceStr, codeStr
 
 func (self *JSXEth) PushTx(txStr string) (*JSReceipt, error) {
 	tx := types.NewTransactionFromBytes(fromHex(txStr))
-	err := self.obj.TxPool().Add(tx)
+	err := self.obj.TxPool().AddLocal(tx)
 	if err != nil {
 		return nil, err
 	}
@@ -10,6 +10,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethutil"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/state"
+	"github.com/ethereum/go-ethereum/vm"
 )
 
 func toHex(b []byte) string {
@@ -204,6 +205,62 @@ func NewJSReciept(contractCreation bool, creationAddress, hash, address []byte)
 	}
 }
 
+// Receipt of a transaction included in the canonical chain
+type JSTxReceipt struct {
+	TxHash            string  `json:"txHash"`
+	BlockHash         string  `json:"blockHash"`
+	BlockNumber       int     `json:"blockNumber"`
+	Index             int     `json:"index"`
+	ContractAddress   string  `json:"contractAddress"`
+	PostState         string  `json:"postState"`
+	CumulativeGasUsed string  `json:"cumulativeGasUsed"`
+	Bloom             string  `json:"bloom"`
+	Logs              []JSLog `json:"logs"`
+}
+
+func NewJSTxReceipt(tx *types.Transaction, block *types.Block, index uint64, receipt *types.Receipt) *JSTxReceipt {
+	var contractAddress string
+	if core.MessageCreatesContract(tx) {
+		contractAddress = toHex(core.AddressFromMessage(tx))
+	}
+
+	logs := make([]JSLog, len(receipt.Logs()))
+	for i, log := range receipt.Logs() {
+		logs[i] = NewJSLog(log)
+	}
+
+	return &JSTxReceipt{
+		TxHash:            toHex(tx.Hash()),
+		BlockHash:         toHex(block.Hash()),
+		BlockNumber:       int(block.NumberU64()),
+		Index:             int(index),
+		ContractAddress:   contractAddress,
+		PostState:         toHex(receipt.PostState),
+		CumulativeGasUsed: receipt.CumulativeGasUsed.String(),
+		Bloom:             toHex(receipt.Bloom),
+		Logs:              logs,
+	}
+}
+
+type JSLog struct {
+	Address string   `json:"address"`
+	Topics  []string `json:"topics"`
+	Data    string   `json:"data"`
+}
+
+func NewJSLog(log state.Log) JSLog {
+	topics := make([]string, len(log.Topics()))
+	for i, topic := range log.Topics() {
+		topics[i] = toHex(topic)
+	}
+
+	return JSLog{
+		Address: toHex(log.Address()),
+		Topics:  topics,
+		Data:    toHex(log.Data()),
+	}
+}
+
 type JSMessage struct {
 	To        string `json:"to"`
 	From      string `json:"from"`
@@ -233,3 +290,116 @@ func NewJSMessage(message *state.Message) JSMessage {
 		Value:     message.Value.String(),
 	}
 }
+
+type JSTrace struct {
+	Gas         string         `json:"gas"`
+	ReturnValue string         `json:"returnValue"`
+	Error       string         `json:"error,omitempty"`
+	StructLogs  []vm.StructLog `json:"structLogs"`
+}
+
+func NewJSTrace(logger *vm.StructLogger) *JSTrace {
+	trace := &JSTrace{
+		Gas:         ethutil.Big0.String(),
+		ReturnValue: toHex(logger.Output()),
+		StructLogs:  logger.StructLogs(),
+	}
+	if logger.GasUsed() != nil {
+		trace.Gas = logger.GasUsed().String()
+	}
+	if logger.Error() != nil {
+		trace.Error = logger.Error().Error()
+	}
+	if trace.StructLogs == nil {
+		trace.StructLogs = []vm.StructLog{}
+	}
+
+	return trace
+}
+
+// JSProof holds an account of the state of a block together with the merkle
+// proofs of the account and of the requested storage slots. The account proof
+// is checked against the state root of the block, the storage proofs against
+// StorageHash.
+type JSProof struct {
+	Address      string            `json:"address"`
+	Balance      string            `json:"balance"`
+	Nonce        uint64            `json:"nonce"`
+	CodeHash     string            `json:"codeHash"`
+	StorageHash  string            `json:"storageHash"`
+	AccountProof []string          `json:"accountProof"`
+	StorageProof []*JSStorageProof `json:"storageProof"`
+}
+
+type JSStorageProof struct {
+	Key   string   `json:"key"`
+	Value string   `json:"value"`
+	Proof []string `json:"proof"`
+}
+
+func NewJSProof(statedb *state.StateDB, object *state.StateObject, keys [][]byte) *JSProof {
+	proof := &JSProof{
+		Address:      toHex(object.Address()),
+		Balance:      object.Balance().String(),
+		Nonce:        object.Nonce,
+		CodeHash:     toHex(object.CodeHash()),
+		StorageHash:  toHex(object.Root()),
+		AccountProof: toHexList(statedb.Prove(object.Address())),
+		StorageProof: make([]*JSStorageProof, len(keys)),
+	}
+	for i, key := range keys {
+		slot := ethutil.BigD(key)
+		proof.StorageProof[i] = &JSStorageProof{
+			Key:   toHex(key),
+			Value: toHex(object.GetStorage(slot).Bytes()),
+			Proof: toHexList(object.ProveStorage(slot)),
+		}
+	}
+
+	return proof
+}
+
+func toHexList(list [][]byte) []string {
+	hexes := make([]string, len(list))
+	for i, b := range list {
+		hexes[i] = toHex(b)
+	}
+
+	return hexes
+}
+
+// JSAccountDiff is an account changed between two states, see state.Diff
+type JSAccountDiff struct {
+	Address     string           `json:"address"`
+	OldBalance  string           `json:"oldBalance"`
+	NewBalance  string           `json:"newBalance"`
+	OldNonce    uint64           `json:"oldNonce"`
+	NewNonce    uint64           `json:"newNonce"`
+	OldCodeHash string           `json:"oldCodeHash"`
+	NewCodeHash string           `json:"newCodeHash"`
+	Storage     []*JSStorageDiff `json:"storage"`
+}
+
+type JSStorageDiff struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+func NewJSAccountDiff(diff *state.AccountDiff) *JSAccountDiff {
+	jsdiff := &JSAccountDiff{
+		Address:     toHex(diff.Address),
+		OldBalance:  diff.OldBalance.String(),
+		NewBalance:  diff.NewBalance.String(),
+		OldNonce:    diff.OldNonce,
+		NewNonce:    diff.NewNonce,
+		OldCodeHash: toHex(diff.OldCodeHash),
+		NewCodeHash: toHex(diff.NewCodeHash),
+		Storage:     make([]*JSStorageDiff, len(diff.Storage)),
+	}
+	for i, slot := range diff.Storage {
+		jsdiff.Storage[i] = &JSStorageDiff{Key: toHex(slot.Key), Old: toHex(slot.Old), New: toHex(slot.New)}
+	}
+
+	return jsdiff
+}
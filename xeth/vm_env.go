@@ -16,11 +16,13 @@ type VMEnv struct {
 	value  *big.Int
 	sender []byte
 
-	depth int
+	depth      int
+	frameDepth int
 }
 
 func NewEnv(chain *core.ChainManager, state *state.StateDB, block *types.Block, value *big.Int, sender []byte) *VMEnv {
 	return &VMEnv{
+		chain:  chain,
 		state:  state,
 		block:  block,
 		value:  value,
@@ -39,6 +41,15 @@ func (self *VMEnv) Value() *big.Int       { return self.value }
 func (self *VMEnv) State() *state.StateDB { return self.state }
 func (self *VMEnv) Depth() int            { return self.depth }
 func (self *VMEnv) SetDepth(i int)        { self.depth = i }
+func (self *VMEnv) FrameDepth() int       { return self.frameDepth }
+func (self *VMEnv) SetFrameDepth(i int)   { self.frameDepth = i }
+func (self *VMEnv) GasTable() *vm.GasTable {
+	return self.chain.Config().RulesAt(self.block.Number()).GasTable
+}
+func (self *VMEnv) JumpTable() *vm.JumpTable {
+	return self.chain.Config().RulesAt(self.block.Number()).JumpTable
+}
+func (self *VMEnv) Tracer() vm.Tracer { return nil }
 func (self *VMEnv) GetHash(n uint64) []byte {
 	if block := self.chain.GetBlockByNumber(n); block != nil {
 		return block.Hash()
@@ -63,7 +74,7 @@ func (self *VMEnv) Call(me vm.ContextRef, addr, data []byte, gas, price, value *
 }
 func (self *VMEnv) CallCode(me vm.ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error) {
 	exe := self.vm(me.Address(), data, gas, price, value)
-	return exe.Call(addr, me)
+	return exe.CallCode(addr, me)
 }
 
 func (self *VMEnv) Create(me vm.ContextRef, addr, data []byte, gas, price, value *big.Int) ([]byte, error, vm.ContextRef) {
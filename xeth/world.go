@@ -1,6 +1,11 @@
 package xeth
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/state"
 )
@@ -25,6 +30,48 @@ func (self *World) State() *state.StateDB {
 	return self.pipe.chainManager.State()
 }
 
+// StateAt returns the state of the block chosen by selector, which is either
+// a decimal or 0x prefixed hex block number, a hex encoded block hash,
+// "latest" for the head of the chain or "pending" for a copy of the head
+// state with the transactions sent from this node applied. An empty selector
+// is "latest".
+func (self *World) StateAt(selector string) (*state.StateDB, error) {
+	var block *types.Block
+	switch {
+	case selector == "" || selector == "latest":
+		return self.State(), nil
+	case selector == "pending":
+		return self.pipe.chainManager.TransState().Copy(), nil
+	case len(strings.TrimPrefix(selector, "0x")) == 64:
+		block = self.pipe.chainManager.GetBlock(fromHex(selector))
+	default:
+		num, base := selector, 10
+		if strings.HasPrefix(num, "0x") {
+			num, base = num[2:], 16
+		}
+		number, err := strconv.ParseUint(num, base, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block selector %q", selector)
+		}
+		block = self.pipe.chainManager.GetBlockByNumber(number)
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %s not found", selector)
+	}
+
+	return self.pipe.chainManager.StateAt(block.Root())
+}
+
+// CommittedStateAt is StateAt for the selectors of blocks. The changes of the
+// pending state aren't committed to its trie, so it's rejected.
+func (self *World) CommittedStateAt(selector string) (*state.StateDB, error) {
+	if selector == "pending" {
+		return nil, fmt.Errorf("the pending state isn't supported, choose a block")
+	}
+
+	return self.StateAt(selector)
+}
+
 func (self *World) Get(addr []byte) *Object {
 	return &Object{self.State().GetStateObject(addr)}
 }
@@ -33,8 +80,22 @@ func (self *World) SafeGet(addr []byte) *Object {
 	return &Object{self.safeGet(addr)}
 }
 
+// SafeGetAt is SafeGet on the state of the block chosen by selector
+func (self *World) SafeGetAt(addr []byte, selector string) (*Object, error) {
+	statedb, err := self.StateAt(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{self.safeGetFrom(statedb, addr)}, nil
+}
+
 func (self *World) safeGet(addr []byte) *state.StateObject {
-	object := self.State().GetStateObject(addr)
+	return self.safeGetFrom(self.State(), addr)
+}
+
+func (self *World) safeGetFrom(statedb *state.StateDB, addr []byte) *state.StateObject {
+	object := statedb.GetStateObject(addr)
 	if object == nil {
 		object = state.NewStateObject(addr, self.pipe.obj.Db())
 	}
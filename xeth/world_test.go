@@ -0,0 +1,122 @@
+package xeth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethutil"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+func init() {
+	ethutil.ReadConfig("/tmp/ethtest", "/tmp/ethtest", "ETH")
+}
+
+// testEth is an EthManager holding just a chain
+type testEth struct {
+	db           ethutil.Database
+	eventMux     *event.TypeMux
+	chainManager *core.ChainManager
+}
+
+func (self *testEth) BlockProcessor() *core.BlockProcessor { return nil }
+func (self *testEth) ChainManager() *core.ChainManager     { return self.chainManager }
+func (self *testEth) TxPool() *core.TxPool                 { return nil }
+func (self *testEth) PeerCount() int                       { return 0 }
+func (self *testEth) IsMining() bool                       { return false }
+func (self *testEth) IsListening() bool                    { return false }
+func (self *testEth) Peers() []*p2p.Peer                   { return nil }
+func (self *testEth) KeyManager() *crypto.KeyManager       { return nil }
+func (self *testEth) ClientIdentity() p2p.ClientIdentity   { return nil }
+func (self *testEth) Db() ethutil.Database                 { return self.db }
+func (self *testEth) EventMux() *event.TypeMux             { return self.eventMux }
+
+// newTestEth creates a chain whose block 1 sends 10 wei to the address to
+func newTestEth(t *testing.T, to []byte) *testEth {
+	key, _ := crypto.GenerateKey()
+	from := crypto.Sha3(crypto.FromECDSAPub(&key.PublicKey)[1:])[12:]
+	genesis := &core.Genesis{GasLimit: "1000000", Difficulty: "1", Alloc: map[string]core.GenesisAccount{
+		ethutil.Bytes2Hex(from): {Balance: "1000000000000000000"},
+	}}
+
+	eth := &testEth{eventMux: new(event.TypeMux)}
+	eth.db, _ = ethdb.NewMemDatabase()
+	chainMan, err := core.NewTestChain(eth.db, genesis, nil, eth.eventMux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth.chainManager = chainMan
+
+	tx := types.NewTransactionMessage(to, big.NewInt(10), big.NewInt(100000), big.NewInt(1), nil)
+	tx.SignECDSA(key)
+	if _, err := core.InsertTestBlock(chainMan, make([]byte, 20), types.Transactions{tx}); err != nil {
+		t.Fatal(err)
+	}
+
+	return eth
+}
+
+func TestStateAt(t *testing.T) {
+	to := ethutil.Hex2Bytes("0000000000000000000000000000000000000001")
+	eth := newTestEth(t, to)
+	pipe := NewJSXEth(eth)
+	head := eth.chainManager.CurrentBlock()
+
+	for _, test := range []struct {
+		selector, balance string
+	}{
+		{"", "10"},
+		{"latest", "10"},
+		{"pending", "10"},
+		{"0", "0"},
+		{"1", "10"},
+		{"0x0", "0"},
+		{"0x1", "10"},
+		{ethutil.Bytes2Hex(eth.chainManager.Genesis().Hash()), "0"},
+		{toHex(head.Hash()), "10"},
+	} {
+		balance, err := pipe.BalanceAtBlock(toHex(to), test.selector)
+		if err != nil {
+			t.Errorf("%q: %v", test.selector, err)
+		} else if balance != test.balance {
+			t.Errorf("%q: balance %s, want %s", test.selector, balance, test.balance)
+		}
+	}
+
+	for _, selector := range []string{"earliest", "-1", "0xzz", "2", toHex(make([]byte, 32))} {
+		if _, err := pipe.BalanceAtBlock(toHex(to), selector); err == nil {
+			t.Errorf("%q: expected an error", selector)
+		}
+	}
+}
+
+func TestPendingState(t *testing.T) {
+	to := ethutil.Hex2Bytes("0000000000000000000000000000000000000001")
+	eth := newTestEth(t, to)
+	pipe := NewJSXEth(eth)
+
+	// The pending state is a copy, changing it leaves the transient state alone
+	pending, err := pipe.World().StateAt("pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending.AddBalance(to, big.NewInt(5))
+	if balance := eth.chainManager.TransState().GetBalance(to); balance.Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("transient balance changed to %v", balance)
+	}
+
+	if _, err := pipe.ProofAtBlock(toHex(to), nil, "pending"); err == nil {
+		t.Error("expected an error for a proof of the pending state")
+	}
+	if _, err := pipe.StateDiff("latest", "pending"); err == nil {
+		t.Error("expected an error for a diff against the pending state")
+	}
+	if diffs, err := pipe.StateDiff("0", "latest"); err != nil || len(diffs) == 0 {
+		t.Errorf("expected the changes of block 1, got %d (%v)", len(diffs), err)
+	}
+}
@@ -54,6 +54,16 @@ func (self *XEth) Block(hash []byte) *types.Block {
 	return self.chainManager.GetBlock(hash)
 }
 
+func (self *XEth) Transaction(hash []byte) *types.Transaction {
+	tx, _, _ := self.chainManager.GetTransaction(hash)
+
+	return tx
+}
+
+func (self *XEth) Receipt(txHash []byte) *types.Receipt {
+	return self.chainManager.GetReceipt(txHash)
+}
+
 func (self *XEth) Storage(addr, storageAddr []byte) *ethutil.Value {
 	return self.World().safeGet(addr).GetStorage(ethutil.BigD(storageAddr))
 }
@@ -143,7 +153,7 @@ func (self *XEth) Transact(key *crypto.KeyPair, to []byte, value, gas, price *et
 	coinbase.SetGasPool(block.GasLimit())
 	self.blockProcessor.ApplyTransactions(coinbase, state, block, types.Transactions{tx}, true)
 
-	err := self.obj.TxPool().Add(tx)
+	err := self.obj.TxPool().AddLocal(tx)
 	if err != nil {
 		return nil, err
 	}
@@ -158,7 +168,7 @@ func (self *XEth) Transact(key *crypto.KeyPair, to []byte, value, gas, price *et
 }
 
 func (self *XEth) PushTx(tx *types.Transaction) ([]byte, error) {
-	err := self.obj.TxPool().Add(tx)
+	err := self.obj.TxPool().AddLocal(tx)
 	if err != nil {
 		return nil, err
 	}